@@ -0,0 +1,44 @@
+package gemini
+
+import "time"
+
+/* ===================================[[ Client Certificates ]]=================================== */
+
+// meta is the text that is reported to the user (can panic !)
+func (peer *GeminiPeer) SendCertRequired(meta string) {
+	peer.sendHeader(StatusClientCertRequired, meta)
+}
+
+// meta is the text that is reported to the user (can panic !)
+func (peer *GeminiPeer) SendCertNotAuthorized(meta string) {
+	peer.sendHeader(StatusCertNotAuthorized, meta)
+}
+
+// meta is the text that is reported to the user (can panic !)
+func (peer *GeminiPeer) SendCertNotValid(meta string) {
+	peer.sendHeader(StatusCertNotValid, meta)
+}
+
+// middleware that only lets through peers presenting a client certificate. peers without
+// one are answered with StatusClientCertRequired, and peers whose certificate is expired
+// (or not yet valid) with StatusCertNotValid. handlers can grab the certificate with
+// peer.ClientCert(). eg:
+//
+//	admin := router.Group("/admin")
+//	admin.Use(gemini.RequireClientCert)
+func RequireClientCert(next Handler) Handler {
+	return HandlerFunc(func(peer *GeminiPeer) {
+		cert := peer.ClientCert()
+		if cert == nil {
+			peer.SendCertRequired("A client certificate is required!")
+			return
+		}
+
+		if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			peer.SendCertNotValid("Client certificate is not valid!")
+			return
+		}
+
+		next.ServeGemini(peer)
+	})
+}
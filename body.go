@@ -1,27 +1,359 @@
 package gemini
 
-import "fmt"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
 
 type GeminiBody struct {
-	buf string
+	buf bytes.Buffer
 }
 
 func NewBody() *GeminiBody {
 	return &GeminiBody{}
 }
 
+// returned by NewBodyFromReader() & NewBodyFromFile() when the gemtext is larger than
+// the given limit
+var ErrBodyTooLarge = errors.New("gemini: body exceeds size limit")
+
+// reads a body from r, eg. the output of another process. reading more than maxSize
+// bytes fails with ErrBodyTooLarge, a maxSize <= 0 means no limit
+func NewBodyFromReader(r io.Reader, maxSize int64) (*GeminiBody, error) {
+	body := NewBody()
+	if maxSize > 0 {
+		// read one byte past the limit to tell a body that's exactly maxSize from a larger one
+		r = io.LimitReader(r, maxSize+1)
+	}
+
+	n, err := body.buf.ReadFrom(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && n > maxSize {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
+
+// reads a body from the gemtext file at path, see NewBodyFromReader()
+func NewBodyFromFile(path string, maxSize int64) (*GeminiBody, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// don't bother reading files we already know are too large
+	if info, err := file.Stat(); err == nil && maxSize > 0 && info.Size() > maxSize {
+		return nil, ErrBodyTooLarge
+	}
+
+	body, err := NewBodyFromReader(file, maxSize)
+	if err != nil && err != ErrBodyTooLarge {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return body, err
+}
+
 func (body *GeminiBody) AddHeader(str string) {
-	body.buf += fmt.Sprintf("# %s\n\n", str)
+	fmt.Fprintf(&body.buf, "# %s\n\n", str)
+}
+
+func (body *GeminiBody) AddSubHeader(str string) {
+	fmt.Fprintf(&body.buf, "## %s\n\n", str)
+}
+
+func (body *GeminiBody) AddSubSubHeader(str string) {
+	fmt.Fprintf(&body.buf, "### %s\n\n", str)
 }
 
 func (body *GeminiBody) AddTextLine(str string) {
-	body.buf += str + "\n\n"
+	body.buf.WriteString(str)
+	body.buf.WriteString("\n\n")
 }
 
 func (body *GeminiBody) AddLinkLine(url, text string) {
-	body.buf += fmt.Sprintf("=> %s %s\n\n", url, text)
+	body.addLink(url, text)
+	body.buf.WriteByte('\n')
+}
+
+// adds a single link line, without a blank line after it. newlines would end the line
+// early, so they're percent-encoded in url and replaced by spaces in text
+func (body *GeminiBody) addLink(url, text string) {
+	url = strings.NewReplacer("\r", "%0D", "\n", "%0A").Replace(url)
+	text = strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+	fmt.Fprintf(&body.buf, "=> %s %s\n", url, text)
+}
+
+// same as AddLinkLine(), with url resolved against the url the peer requested (see
+// GeminiPeer.ResolveLink()), so handlers mounted under a prefix can link relative to
+// the page they serve
+func (body *GeminiBody) AddLinkLineRel(peer *GeminiPeer, url, text string) {
+	body.AddLinkLine(peer.ResolveLink(url), text)
+}
+
+// adds a single "* " list line. unlike the other lines it isn't followed by a blank
+// line, so consecutive items form one list
+func (body *GeminiBody) AddListItem(text string) {
+	body.buf.WriteString("* ")
+	body.buf.WriteString(strings.ReplaceAll(text, "\n", " "))
+	body.buf.WriteByte('\n')
+}
+
+// adds a list with an item per element of items
+func (body *GeminiBody) AddList(items []string) {
+	for _, item := range items {
+		body.AddListItem(item)
+	}
+	body.buf.WriteByte('\n')
+}
+
+// adds a quote, each line of text becomes its own "> " line
+func (body *GeminiBody) AddQuote(text string) {
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		body.buf.WriteString("> ")
+		body.buf.WriteString(line)
+		body.buf.WriteByte('\n')
+	}
+	body.buf.WriteByte('\n')
 }
 
 func (body *GeminiBody) AddRaw(data string) {
-	body.buf += data
+	body.buf.WriteString(data)
+}
+
+// adds a preformatted block (eg. code or ascii art) shown as-is by clients. alt is an
+// optional description of the content (eg. "go" or "a cat drawing"). lines of text that
+// would end the block early (those starting with "```") are indented by a space
+func (body *GeminiBody) AddPreformatted(alt, text string) {
+	fmt.Fprintf(&body.buf, "```%s\n", strings.ReplaceAll(alt, "\n", " "))
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "```") {
+			body.buf.WriteByte(' ')
+		}
+		body.buf.WriteString(line)
+		body.buf.WriteByte('\n')
+	}
+	body.buf.WriteString("```\n\n")
+}
+
+// adds an aligned, monospace table inside a preformatted block, eg.
+//
+//	Path   | Hits
+//	-------+-----
+//	/      | 12
+//	/about | 3
+//
+// rows may have fewer (or more) cells than there are headers. columns are sized by
+// display width (see StringWidth()), and newlines in cells are turned into spaces
+func (body *GeminiBody) AddTable(headers []string, rows [][]string) {
+	clean := strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ", "\t", " ")
+
+	columns := len(headers)
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	widths := make([]int, columns)
+	measure := func(row []string) {
+		for i, cell := range row {
+			if w := StringWidth(clean.Replace(cell)); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	measure(headers)
+	for _, row := range rows {
+		measure(row)
+	}
+
+	var table strings.Builder
+	writeRow := func(row []string) {
+		// trailing empty cells are left out, rather than leaving a dangling separator
+		last := -1
+		for i, cell := range row {
+			if strings.TrimSpace(clean.Replace(cell)) != "" {
+				last = i
+			}
+		}
+
+		var line strings.Builder
+		for i := 0; i <= last; i++ {
+			cell := clean.Replace(row[i])
+			if i > 0 {
+				line.WriteString(" | ")
+			}
+			line.WriteString(cell)
+			line.WriteString(strings.Repeat(" ", widths[i]-StringWidth(cell)))
+		}
+		table.WriteString(strings.TrimRight(line.String(), " "))
+		table.WriteByte('\n')
+	}
+
+	if len(headers) > 0 {
+		writeRow(headers)
+		for i, width := range widths {
+			if i > 0 {
+				table.WriteString("-+-")
+			}
+			table.WriteString(strings.Repeat("-", width))
+		}
+		table.WriteByte('\n')
+	}
+	for _, row := range rows {
+		writeRow(row)
+	}
+
+	body.AddPreformatted("table", table.String())
+}
+
+// appends p as-is, so a body can be handed to anything writing to an io.Writer (eg.
+// templates). never fails
+func (body *GeminiBody) Write(p []byte) (int, error) {
+	return body.buf.Write(p)
+}
+
+// same as Write(), for strings
+func (body *GeminiBody) WriteString(s string) (int, error) {
+	return body.buf.WriteString(s)
+}
+
+// appends the formatted text as-is, like fmt.Printf (no newline is added)
+func (body *GeminiBody) Printf(format string, args ...any) {
+	fmt.Fprintf(&body.buf, format, args...)
+}
+
+// same as AddTextLine(), with the line formatted like fmt.Sprintf
+func (body *GeminiBody) AddTextLinef(format string, args ...any) {
+	body.AddTextLine(fmt.Sprintf(format, args...))
+}
+
+// appends the gemtext of other, so fragments (eg. a nav bar or footer) can be built once
+// and reused across pages. other is left untouched
+func (body *GeminiBody) Append(other *GeminiBody) {
+	body.buf.Write(other.buf.Bytes())
+}
+
+// returns a copy of the body, which can be added to without changing the original
+func (body *GeminiBody) Clone() *GeminiBody {
+	clone := NewBody()
+	clone.buf.Write(body.buf.Bytes())
+	return clone
+}
+
+// writes the gemtext built so far to w, implementing io.WriterTo. unlike
+// bytes.Buffer.WriteTo() the body isn't drained, so it can be written again
+func (body *GeminiBody) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(body.buf.Bytes())
+	return int64(n), err
+}
+
+// returns the gemtext built so far. the slice is only valid until the body is modified
+func (body *GeminiBody) Bytes() []byte {
+	return body.buf.Bytes()
+}
+
+// returns the gemtext built so far
+func (body *GeminiBody) String() string {
+	return body.buf.String()
+}
+
+// returns the size of the gemtext built so far, in bytes
+func (body *GeminiBody) Len() int {
+	return body.buf.Len()
+}
+
+// cuts the body down to at most maxSize bytes, dropping whole lines from the end, and
+// appends a notice saying the content was truncated followed by a link to fullURL (if
+// it isn't ""). a preformatted block left open by the cut is closed. the notice counts
+// towards maxSize: if maxSize is too small for it, the link is left out, then the notice
+// itself. returns false (and leaves the body alone) if it already fits
+func (body *GeminiBody) Truncate(maxSize int, fullURL string) bool {
+	if body.buf.Len() <= maxSize {
+		return false
+	}
+
+	// leave room for the notice, and a toggle line closing a preformatted block
+	const closing = "```\n\n"
+	notice := truncationNotice(fullURL)
+	if notice.Len()+len(closing) > maxSize {
+		notice = truncationNotice("")
+	}
+	if notice.Len()+len(closing) > maxSize {
+		notice = NewBody()
+	}
+
+	// keep whole lines
+	data := body.buf.Bytes()
+	limit := maxSize - notice.Len() - len(closing)
+	if limit < 0 {
+		limit = 0
+	}
+	cut := bytes.LastIndexByte(data[:limit], '\n') + 1
+
+	// count toggle lines to see if the cut lands inside a preformatted block
+	pre := false
+	for _, line := range bytes.Split(data[:cut], []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("```")) {
+			pre = !pre
+		}
+	}
+
+	body.buf.Truncate(cut)
+	if pre {
+		body.buf.WriteString(closing)
+	}
+	body.Append(notice)
+	return true
+}
+
+// returns the notice Truncate() appends, linking to fullURL if it isn't ""
+func truncationNotice(fullURL string) *GeminiBody {
+	notice := NewBody()
+	notice.AddTextLine("[Content truncated]")
+	if fullURL != "" {
+		notice.AddSafeLinkLine(fullURL, "Read the full page")
+	}
+	return notice
+}
+
+// gemtext line types are picked by how the line starts
+var gemtextPrefixes = []string{"=>", "#", "```", "*", ">"}
+
+// makes untrusted text (eg. a guestbook entry) safe to place on a gemtext line: newlines
+// are turned into spaces, and text starting like a link, heading, list, quote or
+// preformat toggle line is indented by a space so it's shown as plain text
+func EscapeText(text string) string {
+	text = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(text)
+	for _, prefix := range gemtextPrefixes {
+		if strings.HasPrefix(text, prefix) {
+			return " " + text
+		}
+	}
+
+	return text
+}
+
+// same as AddTextLine(), with str escaped (see EscapeText())
+func (body *GeminiBody) AddSafeTextLine(str string) {
+	body.AddTextLine(EscapeText(str))
+}
+
+// same as AddHeader(), with str escaped (see EscapeText())
+func (body *GeminiBody) AddSafeHeader(str string) {
+	body.AddHeader(EscapeText(str))
+}
+
+// same as AddLinkLine(), with url & text escaped. whitespace in url is percent-encoded
+// so it can't spill into the link's text
+func (body *GeminiBody) AddSafeLinkLine(url, text string) {
+	url = strings.NewReplacer(" ", "%20", "\t", "%09", "\r", "%0D", "\n", "%0A").Replace(url)
+	body.AddLinkLine(url, EscapeText(text))
 }
@@ -0,0 +1,72 @@
+package gemini
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddTable(t *testing.T) {
+	body := NewBody()
+	body.AddTable([]string{"path", "hits", "note"}, [][]string{
+		{"/", "12", "home"},
+		{"a", "bb", ""},
+		{"/about"},
+		{"x", "", "gap"},
+	})
+
+	want := "```table\n" +
+		"path   | hits | note\n" +
+		"-------+------+-----\n" +
+		"/      | 12   | home\n" +
+		"a      | bb\n" +
+		"/about\n" +
+		"x      |      | gap\n" +
+		"```\n\n"
+	if got := body.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	page := func() *GeminiBody {
+		body := NewBody()
+		body.AddHeader("A long page")
+		for i := 0; i < 20; i++ {
+			body.AddTextLine("some text that takes up room")
+		}
+		return body
+	}
+
+	for _, maxSize := range []int{0, 5, 20, 40, 100, 200} {
+		for _, fullURL := range []string{"", "gemini://example.org/full"} {
+			body := page()
+			if !body.Truncate(maxSize, fullURL) {
+				t.Errorf("Truncate(%d, '%s'): reported the body already fit", maxSize, fullURL)
+			}
+			if body.Len() > maxSize {
+				t.Errorf("Truncate(%d, '%s'): got %d bytes:\n%s", maxSize, fullURL, body.Len(), body.String())
+			}
+		}
+	}
+
+	body := page()
+	body.Truncate(200, "gemini://example.org/full")
+	if got := body.String(); !strings.HasSuffix(got, "[Content truncated]\n\n=> gemini://example.org/full Read the full page\n\n") {
+		t.Errorf("got no notice:\n%s", got)
+	}
+
+	if body := page(); body.Truncate(body.Len(), "") {
+		t.Errorf("Truncate() reported cutting a body that fit")
+	}
+}
+
+func TestTruncateClosesPreformatted(t *testing.T) {
+	body := NewBody()
+	body.AddPreformatted("", strings.Repeat("line of code\n", 20))
+	body.Truncate(100, "")
+
+	got := body.String()
+	if len(got) > 100 || strings.Count(got, "```") != 2 {
+		t.Errorf("got:\n%s", got)
+	}
+}
@@ -0,0 +1,107 @@
+package gemini
+
+import (
+	"bytes"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/* ====================================[[ Response Caching ]]===================================== */
+
+type cacheEntry struct {
+	response []byte
+	expires  time.Time
+}
+
+type responseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]cacheEntry
+}
+
+// returns the cached response for key, or nil if there is none (or it expired)
+func (rc *responseCache) get(key string) []byte {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, exists := rc.entries[key]
+	if !exists {
+		return nil
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(rc.entries, key)
+		return nil
+	}
+
+	return entry.response
+}
+
+// caches response under key. if the cache is full, expired entries are dropped first,
+// then the entry closest to expiring
+func (rc *responseCache) put(key string, response []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	now := time.Now()
+	if _, exists := rc.entries[key]; !exists && rc.maxEntries > 0 && len(rc.entries) >= rc.maxEntries {
+		for k, entry := range rc.entries {
+			if now.After(entry.expires) {
+				delete(rc.entries, k)
+			}
+		}
+
+		if len(rc.entries) >= rc.maxEntries {
+			var oldest string
+			for k, entry := range rc.entries {
+				if oldest == "" || entry.expires.Before(rc.entries[oldest].expires) {
+					oldest = k
+				}
+			}
+			delete(rc.entries, oldest)
+		}
+	}
+
+	rc.entries[key] = cacheEntry{response: response, expires: now.Add(rc.ttl)}
+}
+
+// middleware that caches successful (StatusSuccess) responses by their request url for ttl,
+// holding at most maxEntries responses (0 is unbounded). cached responses are replayed
+// as-is without calling the handler, so don't cache pages that differ per peer (eg. ones
+// behind RequireClientCert). eg:
+//
+//	router.Handle("/feed", gemini.Cache(5*time.Minute, 100)(feed))
+func Cache(ttl time.Duration, maxEntries int) Middleware {
+	rc := &responseCache{ttl: ttl, maxEntries: maxEntries, entries: make(map[string]cacheEntry)}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(peer *GeminiPeer) {
+			if response := rc.get(peer.rawURL); response != nil {
+				peer.Write(response)
+				peer.status, _ = strconv.Atoi(string(response[:2]))
+				log.Printf("%s <- CACHED '%s'", peer.GetAddr(), peer.rawURL)
+				return
+			}
+
+			// capture whatever the handler sends (nested caches keep their own copy)
+			parent := peer.capture
+			capture := &bytes.Buffer{}
+			peer.capture = capture
+			defer func() {
+				peer.capture = parent
+				if parent != nil {
+					parent.Write(capture.Bytes())
+				}
+			}()
+
+			next.ServeGemini(peer)
+
+			if response := capture.Bytes(); len(response) > 0 && response[0] == '2' {
+				rc.put(peer.rawURL, response)
+			}
+		})
+	}
+}
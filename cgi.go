@@ -0,0 +1,201 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* =======================================[[ cgiHandler ]]======================================== */
+
+// how long a script may run before it's killed, see cgiHandler.SetTimeout()
+const defaultCGITimeout = 10 * time.Second
+
+type cgiHandler struct {
+	dir     string
+	timeout time.Duration
+}
+
+// runs executables found in dir as CGI scripts. the request path is matched against
+// dir one segment at a time; the first executable file found is run, with whatever
+// remains of the path passed as PATH_INFO. scripts are expected to write a complete
+// gemini response (header included) to stdout, which is relayed to the peer as-is
+func CGIHandler(dir string) *cgiHandler {
+	return &cgiHandler{dir: dir, timeout: defaultCGITimeout}
+}
+
+// sets how long a script may run before it's killed
+func (cHndlr *cgiHandler) SetTimeout(timeout time.Duration) {
+	cHndlr.timeout = timeout
+}
+
+// returns the (still percent-encoded) query of the peer's request
+func (peer *GeminiPeer) rawQuery() string {
+	if i := strings.Index(peer.rawURL, "?"); i != -1 {
+		return peer.rawURL[i+1:]
+	}
+
+	return ""
+}
+
+// builds the CGI/1.1 meta-variables (+ the usual gemini extensions) describing the
+// peer's request
+func (peer *GeminiPeer) cgiEnv(scriptName, pathInfo string) []string {
+	serverName := peer.hostname
+	if host, _, err := net.SplitHostPort(serverName); err == nil {
+		serverName = host
+	}
+
+	serverPort := ""
+	if _, port, err := net.SplitHostPort(peer.sock.LocalAddr().String()); err == nil {
+		serverPort = port
+	}
+
+	remoteHost := peer.GetAddr()
+	if host, _, err := net.SplitHostPort(remoteHost); err == nil {
+		remoteHost = host
+	}
+
+	env := []string{
+		"GATEWAY_INTERFACE=CGI/1.1",
+		"SERVER_PROTOCOL=GEMINI",
+		"SERVER_SOFTWARE=github.com/CPunch/gemini",
+		"GEMINI_URL=" + peer.rawURL,
+		"SERVER_NAME=" + serverName,
+		"SERVER_PORT=" + serverPort,
+		"SCRIPT_NAME=" + scriptName,
+		"PATH_INFO=" + pathInfo,
+		"QUERY_STRING=" + peer.rawQuery(),
+		"REMOTE_ADDR=" + remoteHost,
+		"REMOTE_HOST=" + remoteHost,
+	}
+
+	if cert := peer.ClientCert(); cert != nil {
+		env = append(env,
+			"AUTH_TYPE=Certificate",
+			"REMOTE_USER="+cert.Subject.CommonName,
+			"TLS_CLIENT_HASH="+Fingerprint(cert),
+			"TLS_CLIENT_SUBJECT="+cert.Subject.String(),
+		)
+	}
+
+	return env
+}
+
+// walks the request path until an executable is found. returns the script's path on
+// disk, the part of the request path naming it (SCRIPT_NAME) & the remainder (PATH_INFO)
+func (cHndlr *cgiHandler) findScript(reqPath string) (script, scriptName, pathInfo string, err error) {
+	name, ok := fsName(reqPath)
+	if !ok || name == "." {
+		return "", "", "", fs.ErrNotExist
+	}
+
+	segments := strings.Split(name, "/")
+	for i := range segments {
+		script = filepath.Join(cHndlr.dir, filepath.FromSlash(strings.Join(segments[:i+1], "/")))
+		info, err := os.Stat(script)
+		if err != nil {
+			return "", "", "", err
+		}
+
+		if info.IsDir() {
+			continue
+		}
+
+		// found a file, make sure we can actually run it
+		if info.Mode()&0111 == 0 {
+			return "", "", "", fs.ErrNotExist
+		}
+
+		scriptName = "/" + strings.Join(segments[:i+1], "/")
+		if i+1 < len(segments) {
+			pathInfo = "/" + strings.Join(segments[i+1:], "/")
+		}
+		return script, scriptName, pathInfo, nil
+	}
+
+	return "", "", "", fs.ErrNotExist
+}
+
+func (cHndlr *cgiHandler) ServeGemini(peer *GeminiPeer) {
+	script, scriptName, pathInfo, err := cHndlr.findScript(peer.path)
+	if err != nil {
+		sendFileError(peer, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(peer.Context(), cHndlr.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, script)
+	cmd.Dir = filepath.Dir(script)
+	cmd.Env = append(peer.cgiEnv(scriptName, pathInfo), "PATH="+os.Getenv("PATH"))
+	cmd.Stderr = log.Writer()
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		panic(err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		log.Printf("%s [ERR]: CGI '%s' failed to start: %s", peer.GetAddr(), script, err)
+		peer.sendHeader(StatusCGIError, "CGI script failed!")
+		return
+	}
+
+	// make sure the script doesn't outlive the request (eg. if the peer hangs up)
+	defer func() {
+		cancel()
+		cmd.Wait()
+	}()
+
+	relayResponse(peer, stdout, "CGI script failed!")
+}
+
+// relays a complete gemini response (header included) from a backend to the peer. if the
+// backend produced nothing at all, the peer gets a StatusCGIError with failMeta (can panic !)
+func relayResponse(peer *GeminiPeer, backend io.Reader, failMeta string) {
+	buf := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(buf)
+
+	sz, err := io.ReadAtLeast(backend, *buf, 1)
+	if sz == 0 {
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Printf("%s [ERR]: backend: %s", peer.GetAddr(), err)
+		}
+
+		peer.sendHeader(StatusCGIError, failMeta)
+		return
+	}
+
+	// record the backend's status for Stats() & the access log
+	header := string((*buf)[:sz])
+	if end := strings.IndexAny(header, "\r\n"); end != -1 {
+		header = header[:end]
+	}
+	code, meta, _ := strings.Cut(header, " ")
+	if status, err := strconv.Atoi(code); err == nil && len(code) == 2 {
+		peer.logStatus(status, meta)
+	} else {
+		log.Printf("%s <- backend response", peer.GetAddr())
+	}
+
+	peer.Write((*buf)[:sz])
+	if _, err := io.CopyBuffer(peerWriter{peer}, struct{ io.Reader }{backend}, *buf); err != nil {
+		panic(err)
+	}
+}
+
+// same as ServeGemini(), can be passed to GeminiServer.Run()
+func (cHndlr *cgiHandler) HandlePeer(peer *GeminiPeer) {
+	cHndlr.ServeGemini(peer)
+}
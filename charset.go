@@ -0,0 +1,87 @@
+package gemini
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+/* ========================================[[ Charsets ]]========================================= */
+
+// decodes latin-1 (iso-8859-1), whose bytes are the first 256 unicode code points
+type latin1Reader struct {
+	r   io.Reader
+	buf []byte
+	out []byte // decoded bytes that didn't fit in the last Read()
+}
+
+func (reader *latin1Reader) Read(p []byte) (int, error) {
+	if len(reader.out) == 0 {
+		if cap(reader.buf) == 0 {
+			reader.buf = make([]byte, 1024)
+		}
+
+		n, err := reader.r.Read(reader.buf)
+		for _, b := range reader.buf[:n] {
+			reader.out = utf8.AppendRune(reader.out, rune(b))
+		}
+		if n == 0 {
+			return 0, err
+		}
+	}
+
+	n := copy(p, reader.out)
+	reader.out = reader.out[n:]
+	return n, nil
+}
+
+// charsets that are already valid utf-8
+var utf8Charsets = map[string]bool{"utf-8": true, "utf8": true, "us-ascii": true, "ascii": true}
+
+// charsets decoded without help from Client.CharsetReader
+var latin1Charsets = map[string]bool{"iso-8859-1": true, "iso_8859-1": true, "latin1": true, "l1": true}
+
+// wraps the body of a text response in a decoder, if it isn't utf-8 already. the charset
+// parameter of the response's meta is updated to match the decoded body
+func (client *Client) transcode(resp *Response) error {
+	charset := resp.Charset()
+	if charset == "" || utf8Charsets[charset] {
+		return nil
+	}
+
+	var decoded io.Reader
+	switch {
+	case latin1Charsets[charset]:
+		decoded = &latin1Reader{r: resp.Body}
+	case client.CharsetReader != nil:
+		var err error
+		if decoded, err = client.CharsetReader(charset, resp.Body); err != nil {
+			return err
+		}
+	default:
+		return nil // left as-is
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{decoded, resp.Body}
+
+	// rebuild the meta with charset=utf-8
+	mediaType, params := resp.mediaType()
+	params["charset"] = "utf-8"
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var meta strings.Builder
+	meta.WriteString(mediaType)
+	for _, key := range keys {
+		meta.WriteString("; " + key + "=" + params[key])
+	}
+	resp.Meta = meta.String()
+	return nil
+}
@@ -0,0 +1,552 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a request received by a testCapsule
+type capsuleRequest struct {
+	URL  string
+	Cert *x509.Certificate // the client certificate sent, if any
+}
+
+// a local TLS server standing in for every host its client dials. each request is
+// answered by respond, which writes the whole response (header included) to w
+type testCapsule struct {
+	listener net.Listener
+	cert     *x509.Certificate
+	respond  func(w io.Writer, request string)
+
+	mu       sync.Mutex
+	requests []capsuleRequest
+	dialed   []string
+}
+
+func newTestCapsule(t *testing.T, respond func(w io.Writer, request string)) *testCapsule {
+	t.Helper()
+	identity, err := GenerateClientCert("localhost", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{identity.Certificate},
+		ClientAuth:   tls.RequestClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capsule := &testCapsule{listener: listener, cert: identity.Certificate.Leaf, respond: respond}
+	go capsule.serve()
+	t.Cleanup(func() { listener.Close() })
+	return capsule
+}
+
+func (capsule *testCapsule) serve() {
+	for {
+		conn, err := capsule.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			request := capsuleRequest{URL: strings.TrimSuffix(line, "\r\n")}
+			if certs := conn.(*tls.Conn).ConnectionState().PeerCertificates; len(certs) > 0 {
+				request.Cert = certs[0]
+			}
+
+			capsule.mu.Lock()
+			capsule.requests = append(capsule.requests, request)
+			capsule.mu.Unlock()
+
+			capsule.respond(conn, request.URL)
+		}()
+	}
+}
+
+// connects to the capsule, whatever addr is
+func (capsule *testCapsule) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	capsule.mu.Lock()
+	capsule.dialed = append(capsule.dialed, addr)
+	capsule.mu.Unlock()
+
+	return (&net.Dialer{}).DialContext(ctx, network, capsule.listener.Addr().String())
+}
+
+func (capsule *testCapsule) client() *Client {
+	return &Client{DialContext: capsule.dial}
+}
+
+func (capsule *testCapsule) received() []capsuleRequest {
+	capsule.mu.Lock()
+	defer capsule.mu.Unlock()
+
+	return append([]capsuleRequest(nil), capsule.requests...)
+}
+
+// answers requests by their url's path, paths missing from responses get a 51
+func byPath(responses map[string]string) func(w io.Writer, request string) {
+	return func(w io.Writer, request string) {
+		reqPath := "/"
+		if i := strings.Index(strings.TrimPrefix(request, "gemini://"), "/"); i != -1 {
+			reqPath = strings.TrimPrefix(request, "gemini://")[i:]
+		}
+
+		response, exists := responses[reqPath]
+		if !exists {
+			response = "51 not found\r\n"
+		}
+		io.WriteString(w, response)
+	}
+}
+
+// fetches rawURL, returning its body
+func fetchString(t *testing.T, client *Client, rawURL string) (*Response, string) {
+	t.Helper()
+	resp, err := client.Fetch(rawURL)
+	if err != nil {
+		t.Fatalf("%s: %s", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s: reading the body: %s", rawURL, err)
+	}
+	return resp, string(body)
+}
+
+func TestClientFetch(t *testing.T) {
+	capsule := newTestCapsule(t, byPath(map[string]string{
+		"/":     "20 text/gemini; lang=en\r\n# hi\n",
+		"/ask":  "10 name?\r\n",
+		"/gone": "52 gone\r\n",
+	}))
+	client := capsule.client()
+
+	resp, body := fetchString(t, client, "gemini://example.org/")
+	if resp.Status != StatusSuccess || resp.MediaType() != "text/gemini" || resp.Lang() != "en" || body != "# hi\n" {
+		t.Errorf("got %d '%s' %q", resp.Status, resp.Meta, body)
+	}
+	if resp.Fingerprint() != Fingerprint(capsule.cert) {
+		t.Errorf("got fingerprint %s, want %s", resp.Fingerprint(), Fingerprint(capsule.cert))
+	}
+	if dialed := capsule.dialed[0]; dialed != "example.org:1965" {
+		t.Errorf("dialed %s, want example.org:1965", dialed)
+	}
+
+	if resp, _ := fetchString(t, client, "gemini://example.org/ask"); !resp.IsInput() || resp.Meta != "name?" {
+		t.Errorf("got %d '%s'", resp.Status, resp.Meta)
+	}
+
+	resp, _ = fetchString(t, client, "gemini://example.org:1966/gone")
+	var statusErr *StatusError
+	if !errors.As(resp.Err(), &statusErr) || statusErr.Status != 52 {
+		t.Errorf("got %v, want a 52 *StatusError", resp.Err())
+	}
+	if dialed := capsule.dialed[2]; dialed != "example.org:1966" {
+		t.Errorf("dialed %s, want example.org:1966", dialed)
+	}
+}
+
+func TestClientMalformedHeaders(t *testing.T) {
+	tests := []struct {
+		response string
+		err      error
+	}{
+		{"", ErrMalformedResponse},
+		{"hello\r\n", ErrMalformedResponse},
+		{"2 text/gemini\r\n", ErrMalformedResponse},
+		{"20text/gemini\r\n", ErrMalformedResponse},
+		{"20 " + strings.Repeat("a", 1025) + "\r\n", ErrHeaderTooLarge},
+	}
+
+	for _, test := range tests {
+		response := test.response
+		capsule := newTestCapsule(t, func(w io.Writer, request string) {
+			io.WriteString(w, response)
+		})
+
+		if _, err := capsule.client().Fetch("gemini://example.org/"); !errors.Is(err, test.err) {
+			t.Errorf("%.20q: got %v, want %v", response, err, test.err)
+		}
+	}
+}
+
+func TestClientRedirects(t *testing.T) {
+	capsule := newTestCapsule(t, byPath(map[string]string{
+		"/a":     "31 b\r\n",
+		"/b":     "30 /c\r\n",
+		"/c":     "20 text/plain\r\nc\n",
+		"/loop":  "30 /loop2\r\n",
+		"/loop2": "30 /loop\r\n",
+		"/http":  "31 https://example.org/\r\n",
+	}))
+	client := capsule.client()
+
+	var hops []string
+	client.OnRedirect = func(from, to string, status int) {
+		hops = append(hops, fmt.Sprintf("%d %s -> %s", status, from, to))
+	}
+
+	resp, body := fetchString(t, client, "gemini://example.org/a")
+	if resp.URL != "gemini://example.org/c" || body != "c\n" {
+		t.Errorf("got %s %q", resp.URL, body)
+	}
+	want := []string{
+		"31 gemini://example.org/a -> gemini://example.org/b",
+		"30 gemini://example.org/b -> gemini://example.org/c",
+	}
+	if strings.Join(hops, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got redirects %q, want %q", hops, want)
+	}
+
+	if _, err := client.Fetch("gemini://example.org/loop"); !errors.Is(err, ErrRedirectLoop) {
+		t.Errorf("got %v, want ErrRedirectLoop", err)
+	}
+	if _, err := client.Fetch("gemini://example.org/http"); !errors.Is(err, ErrCrossSchemeRedirect) {
+		t.Errorf("got %v, want ErrCrossSchemeRedirect", err)
+	}
+
+	client.MaxRedirects = 1
+	if _, err := client.Fetch("gemini://example.org/a"); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("got %v, want ErrTooManyRedirects", err)
+	}
+
+	client.MaxRedirects = -1
+	if resp, _ := fetchString(t, client, "gemini://example.org/a"); resp.Status != StatusRedirectPerm || resp.Meta != "b" {
+		t.Errorf("got %d '%s', want the redirect itself", resp.Status, resp.Meta)
+	}
+}
+
+func TestClientKnownHosts(t *testing.T) {
+	respond := byPath(map[string]string{"/": "20 text/gemini\r\nhi\n"})
+	first, second := newTestCapsule(t, respond), newTestCapsule(t, respond)
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	known, err := LoadKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := first.client()
+	client.KnownHosts = known
+	fetchString(t, client, "gemini://example.org/")
+	fetchString(t, client, "gemini://example.org/")
+
+	// the file is saved as hosts are trusted
+	reloaded, err := LoadKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := reloaded.Lookup("example.org"); entry.Fingerprint != Fingerprint(first.cert) {
+		t.Errorf("known as %s, want %s", entry.Fingerprint, Fingerprint(first.cert))
+	}
+
+	// same host, another certificate
+	client.DialContext = second.dial
+	var mismatch *CertMismatchError
+	if _, err := client.Fetch("gemini://example.org/"); !errors.As(err, &mismatch) || !errors.Is(err, ErrCertMismatch) {
+		t.Fatalf("got %v, want a *CertMismatchError", err)
+	}
+	if mismatch.Received != Fingerprint(second.cert) {
+		t.Errorf("got received %s, want %s", mismatch.Received, Fingerprint(second.cert))
+	}
+
+	// other ports are other capsules
+	fetchString(t, client, "gemini://example.org:1966/")
+}
+
+func TestClientBodyLimits(t *testing.T) {
+	capsule := newTestCapsule(t, byPath(map[string]string{
+		"/small": "20 text/plain\r\n0123456789",
+		"/big":   "20 text/plain\r\n" + strings.Repeat("x", 64*1024),
+	}))
+	client := capsule.client()
+	client.MaxBodySize = 10
+
+	if resp, body := fetchString(t, client, "gemini://example.org/small"); body != "0123456789" || resp.Truncated {
+		t.Errorf("got %q (truncated: %v)", body, resp.Truncated)
+	}
+
+	resp, err := client.Fetch("gemini://example.org/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !errors.Is(err, ErrBodyTooLarge) || len(body) != 10 {
+		t.Errorf("got %d bytes & %v, want 10 bytes & ErrBodyTooLarge", len(body), err)
+	}
+
+	client.TruncateBodies = true
+	if resp, body := fetchString(t, client, "gemini://example.org/big"); len(body) != 10 || !resp.Truncated {
+		t.Errorf("got %d bytes (truncated: %v), want 10 truncated bytes", len(body), resp.Truncated)
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	hang := make(chan struct{})
+	capsule := newTestCapsule(t, func(w io.Writer, request string) {
+		if strings.HasSuffix(request, "/slow-body") {
+			io.WriteString(w, "20 text/plain\r\nstart")
+		}
+		<-hang
+	})
+	t.Cleanup(func() { close(hang) })
+
+	client := capsule.client()
+	client.HeaderTimeout = 50 * time.Millisecond
+	if _, err := client.Fetch("gemini://example.org/slow-header"); !errors.Is(err, ErrHeaderTimeout) {
+		t.Errorf("got %v, want ErrHeaderTimeout", err)
+	}
+
+	client.BodyTimeout = 50 * time.Millisecond
+	resp, err := client.Fetch("gemini://example.org/slow-body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !errors.Is(err, ErrBodyTimeout) || string(body) != "start" {
+		t.Errorf("got %q & %v, want 'start' & ErrBodyTimeout", body, err)
+	}
+
+	// a whole request timeout is reported as such
+	client = capsule.client()
+	client.Timeout = 50 * time.Millisecond
+	if _, err := client.Fetch("gemini://example.org/slow-header"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+
+	// a dialer that never connects
+	client = &Client{ConnectTimeout: 50 * time.Millisecond}
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if _, err := client.Fetch("gemini://example.org/"); !errors.Is(err, ErrConnectTimeout) {
+		t.Errorf("got %v, want ErrConnectTimeout", err)
+	}
+}
+
+func TestClientHostLimiter(t *testing.T) {
+	capsule := newTestCapsule(t, byPath(map[string]string{"/": "20 text/plain\r\nhi\n"}))
+	client := capsule.client()
+	client.HostLimiter = &HostLimiter{Interval: 50 * time.Millisecond}
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		fetchString(t, client, "gemini://example.org/")
+	}
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+		t.Errorf("3 requests took %s, want at least 100ms", elapsed)
+	}
+
+	// one request at a time, until its body is closed
+	client.HostLimiter = &HostLimiter{}
+	resp, err := client.Fetch("gemini://example.org/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.FetchContext(ctx, "gemini://example.org/"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded while the host is busy", err)
+	}
+
+	// other hosts aren't held up
+	fetchString(t, client, "gemini://other.example.org/")
+
+	resp.Body.Close()
+	fetchString(t, client, "gemini://example.org/")
+}
+
+// a SOCKS5 proxy (RFC 1928 & 1929) that connects every CONNECT to capsule, recording the
+// host & port asked for
+func socksProxy(t *testing.T, capsule *testCapsule, user, pass string) (addr string, targets <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	connects := make(chan string, 8)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				if target, err := socksAccept(conn, user, pass); err == nil {
+					connects <- target
+					upstream, err := net.Dial("tcp", capsule.listener.Addr().String())
+					if err != nil {
+						return
+					}
+					defer upstream.Close()
+
+					go io.Copy(upstream, conn)
+					io.Copy(conn, upstream)
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), connects
+}
+
+func socksAccept(conn net.Conn, user, pass string) (string, error) {
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, greeting[1])); err != nil {
+		return "", err
+	}
+
+	if user == "" {
+		conn.Write([]byte{0x05, 0x00})
+	} else {
+		conn.Write([]byte{0x05, 0x02})
+		auth := make([]byte, 2)
+		io.ReadFull(conn, auth)
+		gotUser := make([]byte, auth[1])
+		io.ReadFull(conn, gotUser)
+		io.ReadFull(conn, auth[:1])
+		gotPass := make([]byte, auth[0])
+		io.ReadFull(conn, gotPass)
+
+		if string(gotUser) != user || string(gotPass) != pass {
+			conn.Write([]byte{0x01, 0x01})
+			return "", errors.New("bad credentials")
+		}
+		conn.Write([]byte{0x01, 0x00})
+	}
+
+	// VER CMD RSV ATYP, only domain names are expected
+	request := make([]byte, 5)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	target := make([]byte, int(request[4])+2)
+	if _, err := io.ReadFull(conn, target); err != nil {
+		return "", err
+	}
+	port := int(target[len(target)-2])<<8 | int(target[len(target)-1])
+
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	return fmt.Sprintf("%s:%d", target[:len(target)-2], port), nil
+}
+
+func TestClientSOCKS5(t *testing.T) {
+	capsule := newTestCapsule(t, byPath(map[string]string{"/": "20 text/plain\r\nhi\n"}))
+
+	addr, targets := socksProxy(t, capsule, "", "")
+	client := &Client{SOCKSProxy: addr}
+	if _, body := fetchString(t, client, "gemini://example.onion/"); body != "hi\n" {
+		t.Errorf("got %q", body)
+	}
+	if target := <-targets; target != "example.onion:1965" {
+		t.Errorf("proxy connected to %s, want example.onion:1965", target)
+	}
+
+	addr, targets = socksProxy(t, capsule, "user", "secret")
+	client = &Client{SOCKSProxy: "socks5://user:secret@" + addr}
+	fetchString(t, client, "gemini://example.org:1966/")
+	if target := <-targets; target != "example.org:1966" {
+		t.Errorf("proxy connected to %s, want example.org:1966", target)
+	}
+
+	client = &Client{SOCKSProxy: "socks5://user:wrong@" + addr}
+	if _, err := client.Fetch("gemini://example.org/"); err == nil || !strings.Contains(err.Error(), "rejected the credentials") {
+		t.Errorf("got %v, want the credentials rejected", err)
+	}
+}
+
+func TestClientRedirectLoopIDN(t *testing.T) {
+	capsule := newTestCapsule(t, byPath(map[string]string{
+		"/a": "30 gemini://bücher.example/b\r\n",
+		"/b": "30 gemini://bücher.example/a\r\n",
+	}))
+
+	if _, err := capsule.client().Fetch("gemini://bücher.example/a"); !errors.Is(err, ErrRedirectLoop) {
+		t.Errorf("got %v, want ErrRedirectLoop", err)
+	}
+	if requests := capsule.received(); len(requests) != 2 || requests[0].URL != "gemini://xn--bcher-kva.example/a" {
+		t.Errorf("got requests %v", requests)
+	}
+}
+
+func TestClientIdentities(t *testing.T) {
+	identities := map[string]*tls.Certificate{}
+	for _, name := range []string{"default", "example.org", "*.example.org", "a.example.org", "example.org/app/", "b.example.org/x", "*.example.org/x"} {
+		identity, err := GenerateClientCert(name, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identities[name] = &identity.Certificate
+	}
+
+	client := &Client{Certificate: identities["default"], Identities: map[string]*tls.Certificate{}}
+	for pattern, cert := range identities {
+		if pattern != "default" {
+			client.Identities[pattern] = cert
+		}
+	}
+
+	tests := []struct {
+		rawURL string
+		want   string
+	}{
+		{"gemini://other.org/", "default"},
+		{"gemini://example.org/", "example.org"},
+		{"gemini://example.org/app/login", "example.org/app/"},
+		{"gemini://b.example.org/", "*.example.org"},
+		{"gemini://a.example.org/", "a.example.org"},    // same length as "*.example.org"
+		{"gemini://b.example.org/x", "b.example.org/x"}, // same length as "*.example.org/x"
+	}
+
+	// map iteration order changes between runs, the pick mustn't
+	for i := 0; i < 20; i++ {
+		for _, test := range tests {
+			reqURL, _ := url.Parse(test.rawURL)
+			if got := client.certificateFor(reqURL); got != identities[test.want] {
+				t.Fatalf("%s: got '%s', want '%s'", test.rawURL, got.Leaf.Subject.CommonName, test.want)
+			}
+		}
+	}
+
+	// and it's what the capsule sees
+	capsule := newTestCapsule(t, byPath(map[string]string{"/app/": "20 text/plain\r\n"}))
+	client.DialContext = capsule.dial
+	fetchString(t, client, "gemini://example.org/app/")
+	if cert := capsule.received()[0].Cert; cert == nil || cert.Subject.CommonName != "example.org/app/" {
+		t.Errorf("capsule got %v, want 'example.org/app/'", cert)
+	}
+}
@@ -0,0 +1,93 @@
+/* cmd/geminid
+serves a directory as a gemini capsule, either configured by flags or by a config file
+(see the config package), eg.
+
+	geminid -root ./capsule -host example.org -cert cert.pem -key key.pem -cgi /cgi-bin/
+	geminid -config /etc/geminid.toml
+*/
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/CPunch/gemini/config"
+)
+
+// how long active requests get to finish on SIGTERM/SIGINT
+const shutdownGrace = 10 * time.Second
+
+func main() {
+	// get command line flags
+	configFile := flag.String("config", "", "TOML config file (other flags are ignored)")
+	port := flag.String("port", "1965", "listening port")
+	certFile := flag.String("cert", "cert.pem", "certificate PEM file")
+	keyFile := flag.String("key", "key.pem", "key PEM file")
+	root := flag.String("root", ".", "directory to serve")
+	host := flag.String("host", "", "hostname of the capsule")
+	cgiPrefix := flag.String("cgi", "", "url prefix (eg. /cgi-bin/) under which executables in root are run as CGI scripts")
+	listing := flag.Bool("listing", false, "generate listings for directories without an index")
+	logFile := flag.String("log", "", "append logs to this file instead of stderr")
+	flag.Parse()
+
+	var logOut *os.File
+	if *logFile != "" {
+		file, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logOut = file
+		log.SetOutput(file)
+	}
+
+	var cfg *config.Config
+	var err error
+	if *configFile != "" {
+		cfg, err = config.Load(*configFile)
+	} else {
+		cfg, err = config.Parse(nil)
+		if err == nil {
+			cfg.Port = *port
+			cfg.CertFile = *certFile
+			cfg.KeyFile = *keyFile
+			cfg.Hosts = []config.Host{{
+				Hostname:   *host,
+				Root:       *root,
+				Listing:    *listing,
+				IndexFiles: []string{"index.gmi", "index.gemini"},
+				CGIPrefix:  *cgiPrefix,
+			}}
+		}
+	}
+
+	if err == nil {
+		err = serve(cfg)
+	}
+
+	// log.Fatal() would skip closing the log file
+	if err != nil {
+		log.Print(err)
+	}
+	if logOut != nil {
+		logOut.Close()
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// runs a server for cfg until it's shut down by SIGTERM/SIGINT
+func serve(cfg *config.Config) error {
+	server, err := cfg.NewServer()
+	if err != nil {
+		return err
+	}
+
+	server.ReloadOnSIGHUP()
+	server.ShutdownOnSignal(shutdownGrace, func() { log.Print("bye!") })
+	server.Serve(cfg.Handler())
+	return nil
+}
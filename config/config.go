@@ -0,0 +1,576 @@
+/* config/config.go
+loads server configuration (listen port, certificates, virtual hosts, document roots,
+redirects and limits) from a TOML file and builds a ready-to-run server from it, eg.
+
+	port = 1965
+	cert = "cert.pem"
+	key = "key.pem"
+	trusted_proxies = ["127.0.0.1", "10.0.0.0/8"] # may send a PROXY protocol header
+
+	[limits]
+	request_timeout = "10s"
+	bandwidth = 0 # bytes/sec sent to each peer, 0 is unlimited
+
+	[tls]
+	min_version = "1.2"
+	max_version = "1.3"
+	ciphers = ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"] # TLS 1.2 only
+	curves = ["X25519", "P256"]
+
+	[mime]
+	".txt" = "text/plain; charset=utf-8"
+
+	[[host]]
+	hostname = "example.org"
+	root = "/srv/gemini/example.org"
+	listing = true
+	cgi = "/cgi-bin/"
+	cert = "example.org.crt" # picked through SNI, optional
+	key = "example.org.key"
+
+	[[redirect]]
+	from = "/old.gmi"
+	to = "/new.gmi"
+	permanent = true
+
+	[[redirect]]
+	from = "/blog/*" # ':param' segments & "*" are filled in from the request path
+	to = "gemini://blog.example.org/*"
+
+only TOML is supported (a YAML loader would need a dependency), and only the subset
+described in toml.go
+*/
+
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CPunch/gemini"
+)
+
+type Config struct {
+	Port      string
+	CertFile  string
+	KeyFile   string
+	Limits    Limits
+	TLS       TLS
+	MimeTypes map[string]string
+	Hosts     []Host
+	Redirects []Redirect
+
+	// IPs/CIDR ranges allowed to send a PROXY protocol header, see
+	// GeminiServer.SetTrustedProxies()
+	TrustedProxies []string
+
+	// file the config was loaded from, re-read on reload
+	path string
+}
+
+type Limits struct {
+	RequestTimeout time.Duration
+	TimeoutReply   bool
+	Bandwidth      int
+	Workers        int
+	QueueSize      int
+}
+
+// zero values mean the library's defaults, see GeminiServer.SetTLSVersions() etc.
+type TLS struct {
+	MinVersion   uint16
+	MaxVersion   uint16
+	CipherSuites []uint16
+	Curves       []tls.CurveID
+}
+
+type Host struct {
+	// requests for hosts not listed are served by the host with an empty hostname (or
+	// the only host, if there's just one). "*.example.org" matches any subdomain
+	Hostname string
+	Root     string
+
+	// certificate presented to peers asking for Hostname (through SNI), optional
+	CertFile string
+	KeyFile  string
+
+	Listing    bool
+	IndexFiles []string
+
+	// url prefix (eg. "/cgi-bin/") under which executables in Root are run as CGI scripts
+	CGIPrefix string
+}
+
+type Redirect struct {
+	From      string
+	To        string
+	Permanent bool
+}
+
+/* ========================================[[ Decoding ]]========================================= */
+
+// wraps a parsed table, remembering which keys were read so typos can be reported
+type section struct {
+	name  string
+	table map[string]any
+	used  map[string]bool
+	err   error
+}
+
+func newSection(name string, table map[string]any) *section {
+	return &section{name: name, table: table, used: map[string]bool{}}
+}
+
+func (sec *section) fail(key, expected string) {
+	if sec.err == nil {
+		sec.err = fmt.Errorf("%s: '%s' must be %s", sec.name, key, expected)
+	}
+}
+
+func (sec *section) get(key string) (any, bool) {
+	sec.used[key] = true
+	val, exists := sec.table[key]
+	return val, exists
+}
+
+func (sec *section) str(key string, dst *string) {
+	if val, exists := sec.get(key); exists {
+		if str, ok := val.(string); ok {
+			*dst = str
+		} else {
+			sec.fail(key, "a string")
+		}
+	}
+}
+
+func (sec *section) boolean(key string, dst *bool) {
+	if val, exists := sec.get(key); exists {
+		if b, ok := val.(bool); ok {
+			*dst = b
+		} else {
+			sec.fail(key, "a boolean")
+		}
+	}
+}
+
+func (sec *section) integer(key string, dst *int) {
+	if val, exists := sec.get(key); exists {
+		if i, ok := val.(int64); ok {
+			*dst = int(i)
+		} else {
+			sec.fail(key, "an integer")
+		}
+	}
+}
+
+// accepts a port as an integer (port = 1965) or a string (port = "1965")
+func (sec *section) port(key string, dst *string) {
+	if val, exists := sec.get(key); exists {
+		switch port := val.(type) {
+		case int64:
+			if port < 0 || port > 65535 {
+				sec.fail(key, "a port between 0 and 65535")
+				return
+			}
+			*dst = strconv.FormatInt(port, 10)
+		case string:
+			*dst = port
+		default:
+			sec.fail(key, "a port (eg. 1965)")
+		}
+	}
+}
+
+func (sec *section) duration(key string, dst *time.Duration) {
+	var str string
+	sec.str(key, &str)
+	if str == "" {
+		return
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		sec.fail(key, "a duration (eg. \"10s\")")
+		return
+	}
+	*dst = d
+}
+
+func (sec *section) strings(key string, dst *[]string) {
+	val, exists := sec.get(key)
+	if !exists {
+		return
+	}
+
+	arr, ok := val.([]any)
+	if !ok {
+		sec.fail(key, "an array of strings")
+		return
+	}
+
+	strs := make([]string, 0, len(arr))
+	for _, elem := range arr {
+		str, ok := elem.(string)
+		if !ok {
+			sec.fail(key, "an array of strings")
+			return
+		}
+		strs = append(strs, str)
+	}
+	*dst = strs
+}
+
+func (sec *section) tables(key string) []map[string]any {
+	val, exists := sec.get(key)
+	if !exists {
+		return nil
+	}
+
+	tables, ok := val.([]map[string]any)
+	if !ok {
+		sec.fail(key, "an array of tables (eg. [["+key+"]])")
+	}
+	return tables
+}
+
+func (sec *section) subTable(key string) *section {
+	val, exists := sec.get(key)
+	if !exists {
+		return newSection(key, map[string]any{})
+	}
+
+	table, ok := val.(map[string]any)
+	if !ok {
+		sec.fail(key, "a table (eg. ["+key+"])")
+		table = map[string]any{}
+	}
+	return newSection(key, table)
+}
+
+// returns the first error, or complains about keys that were never read
+func (sec *section) done() error {
+	if sec.err != nil {
+		return sec.err
+	}
+
+	for key := range sec.table {
+		if !sec.used[key] {
+			return fmt.Errorf("%s: unknown key '%s'", sec.name, key)
+		}
+	}
+	return nil
+}
+
+/* ========================================[[ Loading ]]========================================== */
+
+// reads and parses the config file at path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg.path = path
+	return cfg, nil
+}
+
+// parses a TOML config
+func Parse(data []byte) (*Config, error) {
+	tree, err := parseTOML(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		Port:      "1965",
+		CertFile:  "cert.pem",
+		KeyFile:   "key.pem",
+		Limits:    Limits{RequestTimeout: 10 * time.Second},
+		MimeTypes: map[string]string{},
+	}
+
+	root := newSection("config", tree)
+	root.port("port", &cfg.Port)
+	root.str("cert", &cfg.CertFile)
+	root.str("key", &cfg.KeyFile)
+	root.strings("trusted_proxies", &cfg.TrustedProxies)
+	for _, source := range cfg.TrustedProxies {
+		if net.ParseIP(source) == nil {
+			if _, _, err := net.ParseCIDR(source); err != nil {
+				return nil, fmt.Errorf("config: bad trusted proxy '%s'", source)
+			}
+		}
+	}
+
+	limits := root.subTable("limits")
+	limits.duration("request_timeout", &cfg.Limits.RequestTimeout)
+	limits.boolean("timeout_reply", &cfg.Limits.TimeoutReply)
+	limits.integer("bandwidth", &cfg.Limits.Bandwidth)
+	limits.integer("workers", &cfg.Limits.Workers)
+	limits.integer("queue", &cfg.Limits.QueueSize)
+	if err := limits.done(); err != nil {
+		return nil, err
+	}
+
+	if err := parseTLS(root.subTable("tls"), &cfg.TLS); err != nil {
+		return nil, err
+	}
+
+	mimeTypes := root.subTable("mime")
+	for ext := range mimeTypes.table {
+		var typ string
+		mimeTypes.str(ext, &typ)
+		cfg.MimeTypes[ext] = typ
+	}
+	if err := mimeTypes.done(); err != nil {
+		return nil, err
+	}
+
+	for i, table := range root.tables("host") {
+		host := Host{IndexFiles: []string{"index.gmi", "index.gemini"}}
+		sec := newSection(fmt.Sprintf("host #%d", i+1), table)
+		sec.str("hostname", &host.Hostname)
+		sec.str("root", &host.Root)
+		sec.boolean("listing", &host.Listing)
+		sec.strings("index", &host.IndexFiles)
+		sec.str("cgi", &host.CGIPrefix)
+		sec.str("cert", &host.CertFile)
+		sec.str("key", &host.KeyFile)
+		if err := sec.done(); err != nil {
+			return nil, err
+		}
+
+		if host.Root == "" {
+			return nil, fmt.Errorf("%s: 'root' is required", sec.name)
+		}
+		if (host.CertFile == "") != (host.KeyFile == "") {
+			return nil, fmt.Errorf("%s: 'cert' and 'key' must be set together", sec.name)
+		}
+		cfg.Hosts = append(cfg.Hosts, host)
+	}
+
+	for i, table := range root.tables("redirect") {
+		var redirect Redirect
+		sec := newSection(fmt.Sprintf("redirect #%d", i+1), table)
+		sec.str("from", &redirect.From)
+		sec.str("to", &redirect.To)
+		sec.boolean("permanent", &redirect.Permanent)
+		if err := sec.done(); err != nil {
+			return nil, err
+		}
+
+		if redirect.From == "" || redirect.To == "" {
+			return nil, fmt.Errorf("%s: 'from' and 'to' are required", sec.name)
+		}
+		cfg.Redirects = append(cfg.Redirects, redirect)
+	}
+
+	if err := root.done(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+func parseTLS(sec *section, dst *TLS) error {
+	var minVersion, maxVersion string
+	var ciphers, curves []string
+	sec.str("min_version", &minVersion)
+	sec.str("max_version", &maxVersion)
+	sec.strings("ciphers", &ciphers)
+	sec.strings("curves", &curves)
+	if err := sec.done(); err != nil {
+		return err
+	}
+
+	for _, version := range []struct {
+		key  string
+		name string
+		dst  *uint16
+	}{{"min_version", minVersion, &dst.MinVersion}, {"max_version", maxVersion, &dst.MaxVersion}} {
+		if version.name == "" {
+			continue
+		}
+
+		id, exists := tlsVersions[version.name]
+		if !exists {
+			return fmt.Errorf("tls: unknown %s '%s' (expected 1.0 - 1.3)", version.key, version.name)
+		}
+		*version.dst = id
+	}
+
+	suites := map[string]uint16{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[suite.Name] = suite.ID
+	}
+
+	for _, name := range ciphers {
+		id, exists := suites[name]
+		if !exists {
+			return fmt.Errorf("tls: unknown cipher suite '%s'", name)
+		}
+		dst.CipherSuites = append(dst.CipherSuites, id)
+	}
+
+	for _, name := range curves {
+		id, exists := tlsCurves[name]
+		if !exists {
+			return fmt.Errorf("tls: unknown curve '%s'", name)
+		}
+		dst.Curves = append(dst.Curves, id)
+	}
+
+	return nil
+}
+
+/* ========================================[[ Building ]]========================================= */
+
+// builds the handler serving a single host
+func (host *Host) handler() gemini.Handler {
+	files := gemini.FileServer(os.DirFS(host.Root))
+	files.SetDirListing(host.Listing)
+	files.SetIndexFiles(host.IndexFiles...)
+
+	if host.CGIPrefix == "" {
+		return files
+	}
+
+	cgi := gemini.CGIHandler(host.Root)
+	return gemini.HandlerFunc(func(peer *gemini.GeminiPeer) {
+		if strings.HasPrefix(peer.GetPath(), host.CGIPrefix) {
+			cgi.ServeGemini(peer)
+		} else {
+			files.ServeGemini(peer)
+		}
+	})
+}
+
+// builds the handler serving every configured host & redirect
+func (cfg *Config) Handler() gemini.Handler {
+	hosts := gemini.NewHostHandler()
+	for i := range cfg.Hosts {
+		host := &cfg.Hosts[i]
+		hndlr := host.handler()
+		if host.Hostname == "" || len(cfg.Hosts) == 1 {
+			hosts.SetDefault(hndlr)
+		}
+		if host.Hostname != "" {
+			hosts.Handle(host.Hostname, hndlr)
+		}
+	}
+
+	// redirects apply to every host, everything else falls through to them
+	router := gemini.NewHandler()
+	for _, redirect := range cfg.Redirects {
+		router.AddRedirect(redirect.From, redirect.To, redirect.Permanent)
+	}
+	router.SetNotFoundHandler(hosts)
+
+	return router
+}
+
+// applies the config's limits, tls settings, mime types (replacing the overrides the
+// server had) & handler to a server. the worker pool, port and certificate paths
+// (including those of hosts) can't be changed on a running server and are ignored
+func (cfg *Config) Apply(server *gemini.GeminiServer) {
+	minVersion := cfg.TLS.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	server.SetTLSVersions(minVersion, cfg.TLS.MaxVersion)
+	server.SetCipherSuites(cfg.TLS.CipherSuites...)
+	server.SetCurvePreferences(cfg.TLS.Curves...)
+
+	server.SetRequestTimeout(cfg.Limits.RequestTimeout, cfg.Limits.TimeoutReply)
+	server.SetBandwidthLimit(cfg.Limits.Bandwidth)
+	server.SetTrustedProxies(cfg.TrustedProxies...) // validated by Parse()
+	server.ClearMimeTypes()                         // so types removed on reload are forgotten
+	for ext, typ := range cfg.MimeTypes {
+		server.AddMimeType(ext, typ)
+	}
+
+	server.SetHandler(cfg.Handler())
+}
+
+// creates a server from the config. if the config was loaded from a file, the file is
+// re-read and applied whenever the server is reloaded (see GeminiServer.Reload())
+func (cfg *Config) NewServer() (*gemini.GeminiServer, error) {
+	server, err := gemini.NewServer(cfg.Port, cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, host := range cfg.Hosts {
+		if host.CertFile != "" {
+			if err := server.AddCertificate(host.CertFile, host.KeyFile); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cfg.Limits.Workers > 0 {
+		server.SetWorkerPool(cfg.Limits.Workers, cfg.Limits.QueueSize)
+	}
+	cfg.Apply(server)
+
+	if cfg.path != "" {
+		path := cfg.path
+		server.OnReload(func(server *gemini.GeminiServer) error {
+			reloaded, err := Load(path)
+			if err != nil {
+				return err
+			}
+
+			reloaded.Apply(server)
+			return nil
+		})
+	}
+
+	return server, nil
+}
+
+// how long ListenAndServe() gives active requests to finish on SIGTERM/SIGINT
+const shutdownGrace = 10 * time.Second
+
+// loads the config file at path and runs a server for it, reloading the config on SIGHUP.
+// returns once the server is shut down by SIGTERM/SIGINT
+func ListenAndServe(path string) error {
+	cfg, err := Load(path)
+	if err != nil {
+		return err
+	}
+
+	server, err := cfg.NewServer()
+	if err != nil {
+		return err
+	}
+
+	server.ReloadOnSIGHUP()
+	server.ShutdownOnSignal(shutdownGrace, nil)
+	server.Serve(cfg.Handler())
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePort(t *testing.T) {
+	for src, want := range map[string]string{
+		"":              "1965",
+		"port = 1966":   "1966",
+		`port = "1967"`: "1967",
+	} {
+		cfg, err := Parse([]byte(src))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", src, err)
+			continue
+		}
+		if cfg.Port != want {
+			t.Errorf("%q: got port %q, want %q", src, cfg.Port, want)
+		}
+	}
+
+	for _, src := range []string{"port = 70000", "port = true"} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Errorf("%q: expected an error", src)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`
+cert = "c.pem"
+
+[limits]
+request_timeout = "5s"
+workers = 8
+
+[mime]
+".txt" = "text/plain"
+
+[[host]]
+hostname = "example.org"
+root = "/srv/example.org"
+
+[[redirect]]
+from = "/old"
+to = "/new"
+permanent = true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.CertFile != "c.pem" || cfg.KeyFile != "key.pem" {
+		t.Errorf("got cert %q & key %q", cfg.CertFile, cfg.KeyFile)
+	}
+	if cfg.Limits.RequestTimeout != 5*time.Second || cfg.Limits.Workers != 8 {
+		t.Errorf("got limits %+v", cfg.Limits)
+	}
+	if cfg.MimeTypes[".txt"] != "text/plain" {
+		t.Errorf("got mime types %v", cfg.MimeTypes)
+	}
+	if len(cfg.Hosts) != 1 || cfg.Hosts[0].Hostname != "example.org" || cfg.Hosts[0].Root != "/srv/example.org" {
+		t.Errorf("got hosts %+v", cfg.Hosts)
+	}
+	if len(cfg.Redirects) != 1 || cfg.Redirects[0] != (Redirect{"/old", "/new", true}) {
+		t.Errorf("got redirects %+v", cfg.Redirects)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"prot = 1965", "unknown key 'prot'"},
+		{"[limits]\nworkers = \"8\"", "'workers' must be an integer"},
+		{"[[host]]\nhostname = \"a\"", "'root' is required"},
+		{"[[host]]\nroot = \"a\"\ncert = \"c\"", "'cert' and 'key' must be set together"},
+		{"[tls]\nmin_version = \"1.4\"", "unknown min_version"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse([]byte(test.src))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got error %v, want it to contain %q", test.src, err, test.want)
+		}
+	}
+}
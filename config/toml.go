@@ -0,0 +1,344 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/* ======================================[[ TOML Parser ]]======================================= */
+
+// a small parser for the subset of TOML used by config files: bare/quoted keys, basic
+// & literal strings, integers, booleans, arrays (may span lines), [tables] and
+// [[arrays of tables]]. dotted keys, floats, dates and inline tables aren't supported
+
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+type tomlError struct {
+	line int
+	msg  string
+}
+
+func (err *tomlError) Error() string {
+	return fmt.Sprintf("line %d: %s", err.line, err.msg)
+}
+
+func (p *tomlParser) fail(format string, args ...any) {
+	panic(&tomlError{line: p.line, msg: fmt.Sprintf(format, args...)})
+}
+
+// parses src into nested map[string]any. tables become map[string]any, arrays of tables
+// []map[string]any and arrays []any
+func parseTOML(src string) (root map[string]any, err error) {
+	p := &tomlParser{src: src, line: 1}
+	defer func() {
+		if r := recover(); r != nil {
+			tErr, ok := r.(*tomlError)
+			if !ok {
+				panic(r)
+			}
+			err = tErr
+		}
+	}()
+
+	root = map[string]any{}
+	current := root
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "[["):
+			p.pos += 2
+			keys := p.tableName("]]")
+			current = p.arrayTable(root, keys)
+		case p.src[p.pos] == '[':
+			p.pos++
+			keys := p.tableName("]")
+			current = p.table(root, keys)
+		default:
+			key := p.key()
+			p.skipBlank(false)
+			p.expect('=')
+			p.skipBlank(false)
+			if _, exists := current[key]; exists {
+				p.fail("duplicate key '%s'", key)
+			}
+			current[key] = p.value()
+		}
+
+		p.endLine()
+	}
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) expect(c byte) {
+	if p.peek() != c {
+		p.fail("expected '%c'", c)
+	}
+	p.pos++
+}
+
+// skips whitespace & comments. if newlines is true, line breaks are skipped too
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// makes sure nothing but a comment follows on the current line
+func (p *tomlParser) endLine() {
+	p.skipBlank(false)
+	if !p.eof() && p.peek() != '\n' {
+		p.fail("unexpected '%c' after value", p.peek())
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) key() string {
+	switch p.peek() {
+	case '"':
+		return p.basicString()
+	case '\'':
+		return p.literalString()
+	}
+
+	start := p.pos
+	for !p.eof() && isBareKeyChar(p.src[p.pos]) {
+		p.pos++
+	}
+
+	if start == p.pos {
+		p.fail("expected a key")
+	}
+	return p.src[start:p.pos]
+}
+
+// parses a (possibly dotted) table name up to the closing delimiter
+func (p *tomlParser) tableName(closing string) []string {
+	var keys []string
+	for {
+		p.skipBlank(false)
+		keys = append(keys, p.key())
+		p.skipBlank(false)
+
+		if strings.HasPrefix(p.src[p.pos:], closing) {
+			p.pos += len(closing)
+			return keys
+		}
+		p.expect('.')
+	}
+}
+
+// walks (creating as needed) the tables named by keys. for arrays of tables the last
+// element is used
+func (p *tomlParser) walk(root map[string]any, keys []string) map[string]any {
+	current := root
+	for _, key := range keys {
+		switch next := current[key].(type) {
+		case nil:
+			table := map[string]any{}
+			current[key] = table
+			current = table
+		case map[string]any:
+			current = next
+		case []map[string]any:
+			current = next[len(next)-1]
+		default:
+			p.fail("key '%s' is not a table", key)
+		}
+	}
+
+	return current
+}
+
+func (p *tomlParser) table(root map[string]any, keys []string) map[string]any {
+	return p.walk(root, keys)
+}
+
+func (p *tomlParser) arrayTable(root map[string]any, keys []string) map[string]any {
+	parent := p.walk(root, keys[:len(keys)-1])
+	last := keys[len(keys)-1]
+
+	table := map[string]any{}
+	switch arr := parent[last].(type) {
+	case nil:
+		parent[last] = []map[string]any{table}
+	case []map[string]any:
+		parent[last] = append(arr, table)
+	default:
+		p.fail("key '%s' is not an array of tables", last)
+	}
+
+	return table
+}
+
+func (p *tomlParser) value() any {
+	switch c := p.peek(); {
+	case c == '"':
+		return p.basicString()
+	case c == '\'':
+		return p.literalString()
+	case c == '[':
+		return p.array()
+	case strings.HasPrefix(p.src[p.pos:], "true"):
+		p.pos += 4
+		return true
+	case strings.HasPrefix(p.src[p.pos:], "false"):
+		p.pos += 5
+		return false
+	case c == '+' || c == '-' || c >= '0' && c <= '9':
+		return p.integer()
+	}
+
+	p.fail("expected a value")
+	return nil
+}
+
+func (p *tomlParser) integer() int64 {
+	start := p.pos
+	if c := p.peek(); c == '+' || c == '-' {
+		p.pos++
+	}
+	for !p.eof() && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '_') {
+		p.pos++
+	}
+
+	num, err := strconv.ParseInt(strings.ReplaceAll(p.src[start:p.pos], "_", ""), 10, 64)
+	if err != nil {
+		p.fail("bad integer '%s'", p.src[start:p.pos])
+	}
+	return num
+}
+
+func (p *tomlParser) literalString() string {
+	p.expect('\'')
+	start := p.pos
+	for !p.eof() && p.src[p.pos] != '\'' {
+		if p.src[p.pos] == '\n' {
+			p.fail("unterminated string")
+		}
+		p.pos++
+	}
+
+	str := p.src[start:p.pos]
+	p.expect('\'')
+	return str
+}
+
+func (p *tomlParser) basicString() string {
+	p.expect('"')
+
+	var str strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			p.fail("unterminated string")
+		}
+
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return str.String()
+		case '\\':
+			str.WriteString(p.escape())
+		default:
+			str.WriteByte(c)
+		}
+	}
+}
+
+func (p *tomlParser) escape() string {
+	if p.eof() {
+		p.fail("unterminated string")
+	}
+
+	c := p.src[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		return "\b"
+	case 't':
+		return "\t"
+	case 'n':
+		return "\n"
+	case 'f':
+		return "\f"
+	case 'r':
+		return "\r"
+	case '"', '\\':
+		return string(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			p.fail("bad unicode escape")
+		}
+
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			p.fail("bad unicode escape")
+		}
+		p.pos += size
+		return string(rune(code))
+	}
+
+	p.fail("bad escape '\\%c'", c)
+	return ""
+}
+
+func (p *tomlParser) array() []any {
+	p.expect('[')
+
+	arr := []any{}
+	for {
+		p.skipBlank(true)
+		if p.peek() == ']' {
+			p.pos++
+			return arr
+		}
+
+		arr = append(arr, p.value())
+		p.skipBlank(true)
+		if p.peek() == ',' {
+			p.pos++
+		} else if p.peek() != ']' {
+			p.fail("expected ',' or ']' in array")
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]any
+	}{
+		{"empty", "", map[string]any{}},
+		{"comments & blank lines", "# a comment\n\n  # another\n", map[string]any{}},
+		{"integers", "a = 1965\nb = -1\nc = +2\nd = 1_000", map[string]any{
+			"a": int64(1965), "b": int64(-1), "c": int64(2), "d": int64(1000),
+		}},
+		{"booleans", "yes = true\nno = false # trailing comment", map[string]any{"yes": true, "no": false}},
+		{"basic strings", `s = "tab\there \"quoted\" \u00e9 \\"`, map[string]any{"s": "tab\there \"quoted\" é \\"}},
+		{"literal strings", `s = 'C:\path\no\escapes'`, map[string]any{"s": `C:\path\no\escapes`}},
+		{"quoted keys", `".txt" = "text/plain"` + "\n'k' = 1", map[string]any{".txt": "text/plain", "k": int64(1)}},
+		{"multi-line arrays", "a = [\n  \"x\", # first\n  'y',\n]\nb = []", map[string]any{
+			"a": []any{"x", "y"}, "b": []any{},
+		}},
+		{"tables", "top = 1\n[limits]\nworkers = 4\n[a.b]\nc = true", map[string]any{
+			"top":    int64(1),
+			"limits": map[string]any{"workers": int64(4)},
+			"a":      map[string]any{"b": map[string]any{"c": true}},
+		}},
+		{"arrays of tables", "[[host]]\nroot = \"a\"\n[[host]]\nroot = \"b\"\n[host.extra]\nx = 1", map[string]any{
+			"host": []map[string]any{
+				{"root": "a"},
+				{"root": "b", "extra": map[string]any{"x": int64(1)}},
+			},
+		}},
+	}
+
+	for _, test := range tests {
+		got, err := parseTOML(test.src)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line string // the error must mention it
+	}{
+		{"a = 1\na = 2", "line 2: duplicate key 'a'"},
+		{"a = \"open", "line 1: unterminated string"},
+		{"a = 1 2", "line 1: unexpected '2'"},
+		{"\n\na =", "line 3: expected a value"},
+		{"a = 1.5", "line 1: unexpected '.'"},
+		{`a = "\q"`, `line 1: bad escape '\q'`},
+		{"a = [1 2]", "line 1: expected ',' or ']'"},
+		{"a = 1\n[a]", "line 2: key 'a' is not a table"},
+		{"[a]\n[[a]]", "line 2: key 'a' is not an array of tables"},
+		{"= 1", "line 1: expected a key"},
+	}
+
+	for _, test := range tests {
+		_, err := parseTOML(test.src)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.line) {
+			t.Errorf("%q: got error %q, want it to contain %q", test.src, err, test.line)
+		}
+	}
+}
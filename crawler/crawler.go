@@ -0,0 +1,229 @@
+/* crawler/crawler.go
+crawls geminispace: pages are fetched breadth first from a set of seed urls, links found in
+gemtext pages are queued (up to a depth limit), robots.txt is honored and requests to the
+same host are spaced out. what's done with each page is up to the OnPage callback, eg.
+
+	c := &crawler.Crawler{MaxDepth: 2, Delay: time.Second}
+	c.OnPage = func(page *crawler.Page) {
+		log.Printf("%s: %d links", page.URL, len(page.Links))
+	}
+	err := c.Run(ctx, "gemini://example.org/")
+*/
+
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/CPunch/gemini"
+)
+
+// a fetched page, handed to Crawler.OnPage
+type Page struct {
+	URL      string
+	Depth    int // 0 for the seeds
+	Response *gemini.Response
+	Body     []byte // the body of success responses, read in full
+
+	// the absolute urls of the page's links (for gemtext pages), queued once OnPage
+	// returns. OnPage may change them, eg. set them to nil to not follow any
+	Links []string
+}
+
+type Crawler struct {
+	Client gemini.Fetcher // nil uses gemini.DefaultClient
+
+	// the robots.txt virtual user agents the crawler answers to, "*" is always honored.
+	// nil is the same as []string{"crawler"}
+	Agents []string
+
+	MaxDepth int           // links are followed this many hops from the seeds, 0 for no limit
+	MaxPages int           // the crawl stops after this many pages, 0 for no limit
+	Delay    time.Duration // minimum time between two requests to the same host
+
+	// if set, only urls it returns true for are queued (eg. to stay on one capsule)
+	Filter func(u *url.URL) bool
+
+	// called with every page fetched, including failed responses (but not requests that
+	// errored, see OnError)
+	OnPage func(page *Page)
+
+	// called with the urls that couldn't be fetched, the crawl goes on regardless
+	OnError func(rawURL string, err error)
+
+	queue     []queued
+	visited   map[string]bool
+	robots    map[string]*robotsRules // by host
+	lastFetch map[string]time.Time    // by host
+	pages     int
+}
+
+type queued struct {
+	url   *url.URL
+	depth int
+}
+
+// crawls from seeds until the queue runs dry, MaxPages is reached or ctx is cancelled
+// (in which case ctx.Err() is returned)
+func (crawler *Crawler) Run(ctx context.Context, seeds ...string) error {
+	crawler.queue = nil
+	crawler.visited = map[string]bool{}
+	crawler.robots = map[string]*robotsRules{}
+	crawler.lastFetch = map[string]time.Time{}
+	crawler.pages = 0
+
+	for _, seed := range seeds {
+		seedURL, err := url.Parse(seed)
+		if err != nil {
+			crawler.fail(seed, err)
+			continue
+		}
+		crawler.enqueue(seedURL, 0)
+	}
+
+	for len(crawler.queue) > 0 {
+		if crawler.MaxPages > 0 && crawler.pages >= crawler.MaxPages {
+			return nil
+		}
+
+		next := crawler.queue[0]
+		crawler.queue = crawler.queue[1:]
+
+		if !crawler.allowed(ctx, next.url) {
+			continue
+		}
+		if err := crawler.crawl(ctx, next); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// queues u, unless it was already seen, isn't gemini or is filtered out
+func (crawler *Crawler) enqueue(u *url.URL, depth int) {
+	u.Fragment = ""
+	key := u.String()
+	if crawler.visited[key] || u.Scheme != "gemini" || u.Host == "" {
+		return
+	}
+	if crawler.Filter != nil && !crawler.Filter(u) {
+		return
+	}
+
+	crawler.visited[key] = true
+	crawler.queue = append(crawler.queue, queued{url: u, depth: depth})
+}
+
+func (crawler *Crawler) fail(rawURL string, err error) {
+	if crawler.OnError != nil {
+		crawler.OnError(rawURL, err)
+	}
+}
+
+// waits out the politeness delay of u's host, then fetches u. returns an error only if ctx
+// was cancelled
+func (crawler *Crawler) fetch(ctx context.Context, u *url.URL) (*gemini.Response, []byte, error) {
+	host := strings.ToLower(u.Host)
+	if wait := time.Until(crawler.lastFetch[host].Add(crawler.Delay)); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		}
+	}
+	defer func() { crawler.lastFetch[host] = time.Now() }()
+
+	var client gemini.Fetcher = gemini.DefaultClient
+	if crawler.Client != nil {
+		client = crawler.Client
+	}
+
+	resp, err := client.FetchContext(ctx, u.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+// reports whether the robots.txt of u's host lets the crawler fetch u, fetching it the
+// first time the host is seen
+func (crawler *Crawler) allowed(ctx context.Context, u *url.URL) bool {
+	host := strings.ToLower(u.Host)
+	rules, fetched := crawler.robots[host]
+	if !fetched {
+		agents := crawler.Agents
+		if agents == nil {
+			agents = []string{"crawler"}
+		}
+
+		// a missing (or unreadable) robots.txt allows everything
+		rules = &robotsRules{}
+		robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+		resp, body, err := crawler.fetch(ctx, robotsURL)
+		if err == nil && resp.IsSuccess() && strings.HasPrefix(resp.MediaType(), "text/") {
+			rules = parseRobots(string(body), agents)
+		}
+		crawler.robots[host] = rules
+	}
+
+	return rules.allowed(u.EscapedPath())
+}
+
+func (crawler *Crawler) crawl(ctx context.Context, next queued) error {
+	resp, body, err := crawler.fetch(ctx, next.url)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	crawler.pages++
+	if err != nil {
+		crawler.fail(next.url.String(), err)
+		return nil
+	}
+
+	page := &Page{URL: next.url.String(), Depth: next.depth, Response: resp}
+	if resp.IsSuccess() {
+		page.Body = body
+	}
+
+	// redirects are followed by the client, so resolve links against where we ended up
+	base := next.url
+	if final, err := url.Parse(resp.URL); err == nil {
+		base = final
+	}
+
+	if resp.IsGemtext() {
+		lines, _ := gemini.ParseGemtext(bytes.NewReader(body)) // can't fail reading memory
+		for _, line := range lines {
+			if link, ok := line.(*gemini.LinkLine); ok {
+				if target, err := base.Parse(link.URL); err == nil {
+					page.Links = append(page.Links, target.String())
+				}
+			}
+		}
+	}
+
+	if crawler.OnPage != nil {
+		crawler.OnPage(page)
+	}
+
+	if crawler.MaxDepth > 0 && next.depth >= crawler.MaxDepth {
+		return nil
+	}
+	for _, link := range page.Links {
+		if target, err := url.Parse(link); err == nil {
+			crawler.enqueue(target, next.depth+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CPunch/gemini"
+)
+
+// a small capsule: "/" links to /one & /two (and a few urls that mustn't be queued),
+// /one links to /three
+func fakeCapsule() *gemini.FakeFetcher {
+	fake := &gemini.FakeFetcher{}
+	fake.Respond("gemini://a.example/", gemini.StatusSuccess, "text/gemini", strings.Join([]string{
+		"# home",
+		"=> one",
+		"=> /two#section",
+		"=> /one#again",
+		"=> gemini://a.example/",
+		"=> https://a.example/",
+		"=> gemini://b.example/",
+	}, "\n"))
+	fake.Respond("gemini://a.example/one", gemini.StatusSuccess, "text/gemini", "=> three\n")
+	fake.Respond("gemini://a.example/two", gemini.StatusSuccess, "text/plain", "=> not-a-link\n")
+	fake.Respond("gemini://a.example/three", gemini.StatusSuccess, "text/gemini", "=> /\n")
+	fake.Respond("gemini://b.example/", gemini.StatusSuccess, "text/gemini", "# b\n")
+	return fake
+}
+
+// runs crawler from seeds, returning the pages it saw as "<depth> <url>"
+func crawl(t *testing.T, crawler *Crawler, seeds ...string) []string {
+	t.Helper()
+	var pages []string
+	crawler.OnPage = func(page *Page) {
+		pages = append(pages, fmt.Sprintf("%d %s", page.Depth, page.URL))
+	}
+
+	if err := crawler.Run(context.Background(), seeds...); err != nil {
+		t.Fatal(err)
+	}
+	return pages
+}
+
+func checkPages(t *testing.T, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got pages:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRun(t *testing.T) {
+	fake := fakeCapsule()
+	pages := crawl(t, &Crawler{Client: fake}, "gemini://a.example/")
+
+	// breadth first, each url once
+	checkPages(t, pages, []string{
+		"0 gemini://a.example/",
+		"1 gemini://a.example/one",
+		"1 gemini://a.example/two",
+		"1 gemini://b.example/",
+		"2 gemini://a.example/three",
+	})
+
+	// robots.txt is fetched once per host
+	robots := 0
+	for _, request := range fake.Requests() {
+		if strings.HasSuffix(request, "/robots.txt") {
+			robots++
+		}
+	}
+	if robots != 2 {
+		t.Errorf("robots.txt fetched %d times, want 2", robots)
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	checkPages(t, crawl(t, &Crawler{Client: fakeCapsule(), MaxDepth: 1}, "gemini://a.example/"), []string{
+		"0 gemini://a.example/",
+		"1 gemini://a.example/one",
+		"1 gemini://a.example/two",
+		"1 gemini://b.example/",
+	})
+
+	checkPages(t, crawl(t, &Crawler{Client: fakeCapsule(), MaxPages: 2}, "gemini://a.example/"), []string{
+		"0 gemini://a.example/",
+		"1 gemini://a.example/one",
+	})
+
+	onlyA := func(u *url.URL) bool { return u.Host == "a.example" }
+	checkPages(t, crawl(t, &Crawler{Client: fakeCapsule(), Filter: onlyA}, "gemini://a.example/", "gemini://b.example/"), []string{
+		"0 gemini://a.example/",
+		"1 gemini://a.example/one",
+		"1 gemini://a.example/two",
+		"2 gemini://a.example/three",
+	})
+
+	// the same seed twice is crawled once
+	checkPages(t, crawl(t, &Crawler{Client: fakeCapsule(), MaxDepth: 1, Filter: onlyA}, "gemini://a.example/", "gemini://a.example/#top"), []string{
+		"0 gemini://a.example/",
+		"1 gemini://a.example/one",
+		"1 gemini://a.example/two",
+	})
+}
+
+func TestRunRobots(t *testing.T) {
+	fake := fakeCapsule()
+	fake.Respond("gemini://a.example/robots.txt", gemini.StatusSuccess, "text/plain", "User-agent: *\nDisallow: /one\n\nUser-agent: mybot\nDisallow: /two\n")
+
+	checkPages(t, crawl(t, &Crawler{Client: fake}, "gemini://a.example/"), []string{
+		"0 gemini://a.example/",
+		"1 gemini://a.example/two",
+		"1 gemini://b.example/",
+	})
+
+	// a named group replaces the "*" one
+	checkPages(t, crawl(t, &Crawler{Client: fake, Agents: []string{"mybot"}}, "gemini://a.example/"), []string{
+		"0 gemini://a.example/",
+		"1 gemini://a.example/one",
+		"1 gemini://b.example/",
+		"2 gemini://a.example/three",
+	})
+}
+
+func TestRunRedirectsAndErrors(t *testing.T) {
+	fake := &gemini.FakeFetcher{}
+	fake.Respond("gemini://a.example/old/", gemini.StatusRedirectPerm, "/new/", "")
+	fake.Respond("gemini://a.example/new/", gemini.StatusSuccess, "text/gemini", "=> page\n=> broken\n")
+	fake.Fail("gemini://a.example/new/broken", errors.New("boom"))
+
+	var failed []string
+	crawler := &Crawler{Client: fake}
+	crawler.OnError = func(rawURL string, err error) {
+		failed = append(failed, rawURL+": "+err.Error())
+	}
+
+	// links are resolved against where the redirect ended up
+	checkPages(t, crawl(t, crawler, "gemini://a.example/old/"), []string{
+		"0 gemini://a.example/old/",
+		"1 gemini://a.example/new/page",
+	})
+	if len(failed) != 1 || failed[0] != "gemini://a.example/new/broken: boom" {
+		t.Errorf("got errors %q", failed)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	crawler := &Crawler{Client: fakeCapsule()}
+	crawler.OnPage = func(page *Page) { cancel() }
+
+	if err := crawler.Run(ctx, "gemini://a.example/"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
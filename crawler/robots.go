@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"bufio"
+	"strings"
+)
+
+// the rules of a robots.txt file that apply to a crawler, see the robots.txt companion
+// spec: gemini://geminiprotocol.net/docs/companion/robots.gmi
+type robotsRules struct {
+	disallow []string // path prefixes
+}
+
+// parses robots.txt, keeping the Disallow rules of the groups addressed to one of agents
+// (or to "*"). a group addressed to one of agents by name replaces the "*" group
+func parseRobots(src string, agents []string) *robotsRules {
+	named := map[string]bool{}
+	for _, agent := range agents {
+		named[strings.ToLower(agent)] = true
+	}
+
+	var wildcard, specific []string
+	var groupAgents []string
+	inRules := false // set once the current group's rules start
+	matchedSpecific := false
+
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// consecutive User-agent lines share a group
+			if inRules {
+				groupAgents, inRules = nil, false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "disallow":
+			inRules = true
+
+			isNamed, isWildcard := false, false
+			for _, agent := range groupAgents {
+				isNamed = isNamed || named[agent]
+				isWildcard = isWildcard || agent == "*"
+			}
+
+			// an empty Disallow allows everything, but still claims the group for us
+			switch {
+			case isNamed:
+				matchedSpecific = true
+				if value != "" {
+					specific = append(specific, value)
+				}
+			case isWildcard && value != "":
+				wildcard = append(wildcard, value)
+			}
+		}
+	}
+
+	if matchedSpecific {
+		return &robotsRules{disallow: specific}
+	}
+	return &robotsRules{disallow: wildcard}
+}
+
+// reports whether the rules let the crawler fetch path
+func (rules *robotsRules) allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+
+	for _, prefix := range rules.disallow {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
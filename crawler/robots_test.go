@@ -0,0 +1,78 @@
+package crawler
+
+import "testing"
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		allowed    []string
+		disallowed []string
+	}{
+		{
+			name:    "empty",
+			src:     "",
+			allowed: []string{"/", "/anything", ""},
+		},
+		{
+			name:       "wildcard group",
+			src:        "User-agent: *\nDisallow: /private\n",
+			allowed:    []string{"/", "/public"},
+			disallowed: []string{"/private", "/private/x", "/privately"},
+		},
+		{
+			name:       "consecutive user-agents share a group",
+			src:        "User-agent: archiver\nUser-agent: crawler\nDisallow: /a\n",
+			allowed:    []string{"/b"},
+			disallowed: []string{"/a"},
+		},
+		{
+			name:       "named group overrides the wildcard",
+			src:        "User-agent: *\nDisallow: /\n\nUser-agent: crawler\nDisallow: /secret\n",
+			allowed:    []string{"/", "/public"},
+			disallowed: []string{"/secret"},
+		},
+		{
+			name:    "empty disallow in the named group allows everything",
+			src:     "User-agent: *\nDisallow: /\n\nUser-agent: crawler\nDisallow:\n",
+			allowed: []string{"/", "/anything"},
+		},
+		{
+			name:       "empty disallow in the wildcard group",
+			src:        "User-agent: *\nDisallow:\nDisallow: /tmp\n",
+			allowed:    []string{"/"},
+			disallowed: []string{"/tmp"},
+		},
+		{
+			name:    "other agents' groups are ignored",
+			src:     "User-agent: indexer\nDisallow: /\n",
+			allowed: []string{"/", "/x"},
+		},
+		{
+			name:       "a user-agent after rules starts a new group",
+			src:        "User-agent: crawler\nDisallow: /a\nUser-agent: indexer\nDisallow: /b\n",
+			allowed:    []string{"/b"},
+			disallowed: []string{"/a"},
+		},
+		{
+			name:       "keys and agents ignore case, comments are dropped",
+			src:        "# robots\nuser-AGENT: Crawler # us\nDISALLOW: /x # not this\n",
+			allowed:    []string{"/y"},
+			disallowed: []string{"/x"},
+		},
+	}
+
+	for _, test := range tests {
+		rules := parseRobots(test.src, []string{"crawler"})
+		for _, path := range test.allowed {
+			if !rules.allowed(path) {
+				t.Errorf("%s: '%s' disallowed", test.name, path)
+			}
+		}
+		for _, path := range test.disallowed {
+			if rules.allowed(path) {
+				t.Errorf("%s: '%s' allowed", test.name, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package gemini
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/* ========================================[[ Downloads ]]======================================== */
+
+// how far along a download is, see Client.Download()
+type Progress struct {
+	Read    int64 // bytes of the body written to disk so far
+	Elapsed time.Duration
+	Done    bool // set on the last report, once the whole body was read
+}
+
+// fetches rawURL and writes its body to the file at path. the body is streamed to a
+// temporary file next to path, which replaces path only once the whole body was read,
+// so a failed download never leaves a partial file behind. progress, if not nil, is
+// called as the body is read and once more when it's done. responses other than success
+// fail with their Response.Err() (or a *StatusError), the response is returned either way
+func (client *Client) Download(rawURL, path string, progress func(Progress)) (*Response, error) {
+	start := time.Now()
+	resp, err := client.Fetch(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !resp.IsSuccess() {
+		if err := resp.Err(); err != nil {
+			return resp, err
+		}
+		return resp, &StatusError{Status: resp.Status, Meta: resp.Meta}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return resp, err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	buf := make([]byte, 32*1024)
+	var read int64
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := tmp.Write(buf[:n]); err != nil {
+				tmp.Close()
+				return resp, err
+			}
+
+			read += int64(n)
+			if progress != nil {
+				progress(Progress{Read: read, Elapsed: time.Since(start)})
+			}
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			tmp.Close()
+			return resp, err
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return resp, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return resp, err
+	}
+
+	if progress != nil {
+		progress(Progress{Read: read, Elapsed: time.Since(start), Done: true})
+	}
+	return resp, nil
+}
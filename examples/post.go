@@ -7,16 +7,11 @@ import (
 	"github.com/CPunch/gemini"
 )
 
-func handleRequest(peer *gemini.GeminiPeer) {
-	if msg, isParam := peer.GetParam(); isParam {
-		// send data back to peer!
-		body := gemini.NewBody()
-		body.AddHeader(msg)
-		peer.SendBody(body)
-	} else {
-		// ask peer for data
-		peer.SendInput("what's ur favorite animal?")
-	}
+func handleAnimal(peer *gemini.GeminiPeer, animal string) {
+	// send data back to peer!
+	body := gemini.NewBody()
+	body.AddHeader(animal)
+	peer.SendBody(body)
 }
 
 func main() {
@@ -32,5 +27,6 @@ func main() {
 		log.Fatal(err)
 	}
 
-	server.Run(handleRequest)
+	// ask peer for data, asking again if it's too long
+	server.Serve(gemini.InputHandler("what's ur favorite animal?", handleAnimal).Validate(gemini.MaxLength(32)))
 }
@@ -0,0 +1,147 @@
+/* feed/feed.go
+builds Atom feeds (RFC 4287) for gemlogs and serves them as application/atom+xml, along
+with gemini native subscription pages (see gmisub.go)
+*/
+
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"sort"
+	"time"
+
+	"github.com/CPunch/gemini"
+)
+
+// mime type atom feeds are served with
+const AtomMimeType = "application/atom+xml"
+
+type Entry struct {
+	Title   string
+	URL     string // absolute url of the post, also used as its id
+	Updated time.Time
+	Summary string // optional
+}
+
+type Feed struct {
+	Title    string
+	URL      string // absolute url of the capsule (or gemlog index), also used as the feed's id
+	FeedURL  string // absolute url the feed itself is served at, optional
+	Author   string
+	Subtitle string // optional
+	Entries  []Entry
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   *atomPerson `xml:"author,omitempty"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+// returns the feed's entries, newest first
+func (feed *Feed) sorted() []Entry {
+	entries := append([]Entry{}, feed.Entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Updated.After(entries[j].Updated)
+	})
+	return entries
+}
+
+// builds the feed's atom document. entries are sorted newest first, and the feed's
+// updated time is that of its newest entry
+func (feed *Feed) Atom() ([]byte, error) {
+	entries := feed.sorted()
+
+	doc := atomFeed{
+		ID:       feed.URL,
+		Title:    feed.Title,
+		Subtitle: feed.Subtitle,
+		Links:    []atomLink{{Href: feed.URL, Rel: "alternate", Type: "text/gemini"}},
+	}
+	if feed.FeedURL != "" {
+		doc.Links = append(doc.Links, atomLink{Href: feed.FeedURL, Rel: "self", Type: AtomMimeType})
+	}
+	if feed.Author != "" {
+		doc.Author = &atomPerson{Name: feed.Author}
+	}
+
+	var updated time.Time
+	for _, entry := range entries {
+		if entry.Updated.After(updated) {
+			updated = entry.Updated
+		}
+
+		doc.Entries = append(doc.Entries, atomEntry{
+			ID:      entry.URL,
+			Title:   entry.Title,
+			Updated: entry.Updated.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: entry.URL, Rel: "alternate"},
+			Summary: entry.Summary,
+		})
+	}
+	if updated.IsZero() {
+		updated = time.Now() // an empty feed, still needs an updated time
+	}
+	doc.Updated = updated.UTC().Format(time.RFC3339)
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+// serves the feed's atom document
+func (feed *Feed) ServeGemini(peer *gemini.GeminiPeer) {
+	data, err := feed.Atom()
+	if err != nil {
+		peer.SendError("Failed to build feed!")
+		return
+	}
+
+	peer.SendSuccess(AtomMimeType, bytes.NewReader(data))
+}
+
+// returns a handler serving the atom document of the feed returned by build, which is
+// called on every request (so new posts show up without a restart). if build fails the
+// peer is answered with StatusTemporaryFailure
+func Handler(build func() (*Feed, error)) gemini.Handler {
+	return gemini.HandlerFunc(func(peer *gemini.GeminiPeer) {
+		feed, err := build()
+		if err != nil {
+			peer.SendError("Failed to build feed!")
+			return
+		}
+
+		feed.ServeGemini(peer)
+	})
+}
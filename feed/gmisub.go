@@ -0,0 +1,43 @@
+package feed
+
+import (
+	"strings"
+
+	"github.com/CPunch/gemini"
+)
+
+// builds a subscription page as described by the companion spec:
+//
+//	gemini://geminiprotocol.net/docs/companion/subscription.gmi
+//
+// the feed's title is the page's heading (its subtitle, if any, the sub heading), followed
+// by a link line per entry, newest first, whose text starts with the entry's date:
+//
+//	=> gemini://example.org/log/hello.gmi 2024-01-02 - Hello world
+func (feed *Feed) Gemsub() *gemini.GeminiBody {
+	body := gemini.NewBody()
+	body.AddSafeHeader(feed.Title)
+	if feed.Subtitle != "" {
+		body.AddSubHeader(gemini.EscapeText(feed.Subtitle))
+	}
+
+	for _, entry := range feed.sorted() {
+		body.AddSafeLinkLine(entry.URL, entry.Updated.Format("2006-01-02")+" - "+strings.TrimSpace(entry.Title))
+	}
+
+	return body
+}
+
+// returns a handler serving the subscription page of the feed returned by build, which is
+// called on every request. if build fails the peer is answered with StatusTemporaryFailure
+func SubscriptionHandler(build func() (*Feed, error)) gemini.Handler {
+	return gemini.HandlerFunc(func(peer *gemini.GeminiPeer) {
+		feed, err := build()
+		if err != nil {
+			peer.SendError("Failed to build feed!")
+			return
+		}
+
+		peer.SendBody(feed.Gemsub())
+	})
+}
@@ -0,0 +1,231 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+/* =====================================[[ Client Caching ]]====================================== */
+
+// a success (20) response as stored by a ResponseCache
+type CachedResponse struct {
+	Meta         string
+	URL          string // see Response.URL
+	Body         []byte
+	Certificates []*x509.Certificate
+	Stored       time.Time
+}
+
+// stores the success responses a Client fetched, see Client.Cache. responses are keyed
+// by the url they were fetched with, followed by the fingerprint of the client
+// certificate sent (if any), so changing identities doesn't serve another identity's
+// pages. it must be safe for concurrent use
+type ResponseCache interface {
+	// returns the response cached under key, or nil if there's none that's still fresh
+	Get(key string) *CachedResponse
+	Put(key string, resp *CachedResponse)
+}
+
+// bodies larger than this aren't cached
+const maxCachedBodySize = 1 << 20
+
+// how long MemoryCache keeps responses unless told otherwise
+const defaultCacheTTL = 5 * time.Minute
+
+// a ResponseCache holding responses in memory. the zero value is ready to use
+type MemoryCache struct {
+	TTL        time.Duration // how long responses stay fresh, 0 picks defaultCacheTTL
+	MaxEntries int           // 0 is unbounded
+	MaxBytes   int64         // the total size of the cached bodies, 0 is unbounded
+
+	mu      sync.Mutex
+	entries map[string]*CachedResponse
+	size    int64
+}
+
+func (cache *MemoryCache) ttl() time.Duration {
+	if cache.TTL <= 0 {
+		return defaultCacheTTL
+	}
+	return cache.TTL
+}
+
+func (cache *MemoryCache) Get(key string) *CachedResponse {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, exists := cache.entries[key]
+	if !exists {
+		return nil
+	}
+
+	if time.Since(entry.Stored) > cache.ttl() {
+		cache.remove(key)
+		return nil
+	}
+
+	return entry
+}
+
+// caches resp under key. if the cache is full, stale entries are dropped first, then
+// the oldest ones until it fits. bodies larger than MaxBytes aren't cached at all
+func (cache *MemoryCache) Put(key string, resp *CachedResponse) {
+	size := int64(len(resp.Body))
+	if cache.MaxBytes > 0 && size > cache.MaxBytes {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.entries == nil {
+		cache.entries = map[string]*CachedResponse{}
+	}
+	cache.remove(key)
+
+	full := func() bool {
+		return (cache.MaxEntries > 0 && len(cache.entries) >= cache.MaxEntries) ||
+			(cache.MaxBytes > 0 && cache.size+size > cache.MaxBytes)
+	}
+
+	if full() {
+		for stale, entry := range cache.entries {
+			if time.Since(entry.Stored) > cache.ttl() {
+				cache.remove(stale)
+			}
+		}
+	}
+
+	for full() {
+		var oldest string
+		for cached, entry := range cache.entries {
+			if oldest == "" || entry.Stored.Before(cache.entries[oldest].Stored) {
+				oldest = cached
+			}
+		}
+		cache.remove(oldest)
+	}
+
+	cache.entries[key] = resp
+	cache.size += size
+}
+
+func (cache *MemoryCache) remove(key string) {
+	if entry, exists := cache.entries[key]; exists {
+		cache.size -= int64(len(entry.Body))
+		delete(cache.entries, key)
+	}
+}
+
+// returns the key rawURL's response is cached under, see ResponseCache
+func (client *Client) cacheKey(rawURL string) string {
+	reqURL, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	if cert := client.certificateFor(reqURL); cert != nil && len(cert.Certificate) > 0 {
+		sum := sha256.Sum256(cert.Certificate[0])
+		return rawURL + " SHA256:" + hex.EncodeToString(sum[:])
+	}
+	return rawURL
+}
+
+// reports whether client.KnownHosts (if set) still trusts the certificate a cached
+// response was fetched with. hits don't connect, so this stands in for the TOFU check
+func (client *Client) stillTrusted(entry *CachedResponse) bool {
+	if client.KnownHosts == nil || len(entry.Certificates) == 0 {
+		return true
+	}
+
+	respURL, err := url.Parse(entry.URL)
+	if err != nil {
+		return false
+	}
+	host := respURL.Hostname()
+	if port := respURL.Port(); port != "" && port != defaultPort {
+		host = net.JoinHostPort(host, port)
+	}
+
+	known, exists := client.KnownHosts.Lookup(host)
+	return exists && known.Fingerprint == Fingerprint(entry.Certificates[0]) && time.Now().Before(known.Expires)
+}
+
+// same as follow(), fresh responses are served from client.Cache and new success
+// responses are stored in it once their body was read in full. hits are only served
+// while client.KnownHosts still trusts the certificate they were fetched with
+func (client *Client) fetchCached(ctx context.Context, rawURL string) (*Response, error) {
+	key := client.cacheKey(rawURL)
+	if entry := client.Cache.Get(key); entry != nil && client.stillTrusted(entry) {
+		return &Response{
+			Status:       StatusSuccess,
+			Meta:         entry.Meta,
+			Body:         io.NopCloser(bytes.NewReader(entry.Body)),
+			URL:          entry.URL,
+			Certificates: entry.Certificates,
+		}, nil
+	}
+
+	resp, err := client.follow(ctx, "", rawURL)
+	if err != nil || resp.Status != StatusSuccess {
+		return resp, err
+	}
+
+	resp.Body = &cachingBody{body: resp.Body, put: func(body []byte) {
+		if resp.Truncated {
+			return
+		}
+
+		client.Cache.Put(key, &CachedResponse{
+			Meta:         resp.Meta,
+			URL:          resp.URL,
+			Body:         body,
+			Certificates: resp.Certificates,
+			Stored:       time.Now(),
+		})
+	}}
+	return resp, nil
+}
+
+// keeps a copy of the body as it's read, which is cached if it's read in full
+type cachingBody struct {
+	body     io.ReadCloser
+	buf      bytes.Buffer
+	complete bool
+	tooLarge bool
+	put      func(body []byte)
+	close    sync.Once
+}
+
+func (body *cachingBody) Read(p []byte) (int, error) {
+	n, err := body.body.Read(p)
+	if !body.tooLarge {
+		body.buf.Write(p[:n])
+		if body.buf.Len() > maxCachedBodySize {
+			body.tooLarge = true
+			body.buf = bytes.Buffer{}
+		}
+	}
+	if err == io.EOF {
+		body.complete = true
+	}
+	return n, err
+}
+
+func (body *cachingBody) Close() error {
+	err := body.body.Close()
+	body.close.Do(func() {
+		if body.complete && !body.tooLarge {
+			body.put(body.buf.Bytes())
+		}
+	})
+	return err
+}
@@ -0,0 +1,141 @@
+package gemini
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+	"time"
+)
+
+func cached(body string, stored time.Time) *CachedResponse {
+	return &CachedResponse{Meta: "text/plain", Body: []byte(body), Stored: stored}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	cache := &MemoryCache{TTL: time.Minute}
+	cache.Put("fresh", cached("a", time.Now()))
+	cache.Put("stale", cached("bb", time.Now().Add(-2*time.Minute)))
+
+	if cache.Get("fresh") == nil {
+		t.Error("fresh entry missing")
+	}
+	if cache.Get("stale") != nil {
+		t.Error("stale entry served")
+	}
+	if cache.size != 1 || len(cache.entries) != 1 {
+		t.Errorf("got %d entries of %d bytes, want 1 of 1", len(cache.entries), cache.size)
+	}
+}
+
+func TestMemoryCacheMaxEntries(t *testing.T) {
+	cache := &MemoryCache{MaxEntries: 2}
+	now := time.Now()
+	cache.Put("a", cached("a", now.Add(-3*time.Second)))
+	cache.Put("b", cached("b", now.Add(-2*time.Second)))
+	cache.Put("c", cached("c", now.Add(-time.Second)))
+
+	if cache.Get("a") != nil || cache.Get("b") == nil || cache.Get("c") == nil {
+		t.Errorf("got %v, want the oldest entry evicted", cache.entries)
+	}
+
+	// replacing an entry doesn't evict another
+	cache.Put("b", cached("b2", now))
+	if cache.Get("c") == nil || string(cache.Get("b").Body) != "b2" {
+		t.Errorf("got %v", cache.entries)
+	}
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	cache := &MemoryCache{MaxBytes: 10}
+	now := time.Now()
+	cache.Put("a", cached("aaaaaa", now.Add(-2*time.Second)))
+	cache.Put("b", cached("bbbbbb", now.Add(-time.Second)))
+
+	if cache.Get("a") != nil || cache.Get("b") == nil || cache.size != 6 {
+		t.Errorf("got %d bytes, want 'a' evicted to fit 'b'", cache.size)
+	}
+
+	// larger than the whole cache
+	cache.Put("c", cached(strings.Repeat("c", 11), now))
+	if cache.Get("c") != nil || cache.Get("b") == nil {
+		t.Error("an oversized body was cached")
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	capsule := newTestCapsule(t, byPath(map[string]string{
+		"/":    "20 text/gemini\r\n# hello\n",
+		"/big": "20 text/plain\r\n" + strings.Repeat("x", maxCachedBodySize+1),
+	}))
+	client := capsule.client()
+	client.Cache = &MemoryCache{}
+
+	// a body that wasn't read in full isn't cached
+	resp, err := client.Fetch("gemini://example.org/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Read(make([]byte, 3))
+	resp.Body.Close()
+
+	fetchString(t, client, "gemini://example.org/")
+	resp, body := fetchString(t, client, "gemini://example.org/")
+	if requests := len(capsule.received()); requests != 2 || body != "# hello\n" {
+		t.Errorf("got %d requests & %q, want 2 & the cached body", requests, body)
+	}
+	if resp.Fingerprint() != Fingerprint(capsule.cert) {
+		t.Error("cached response lost its certificate")
+	}
+
+	fetchString(t, client, "gemini://example.org/big")
+	fetchString(t, client, "gemini://example.org/big")
+	if requests := len(capsule.received()); requests != 4 {
+		t.Errorf("got %d requests, want 4 (bodies over 1 MiB aren't cached)", requests)
+	}
+}
+
+func TestClientCacheIdentities(t *testing.T) {
+	capsule := newTestCapsule(t, byPath(map[string]string{"/": "20 text/gemini\r\n# hello\n"}))
+	client := capsule.client()
+	client.Cache = &MemoryCache{}
+
+	fetchString(t, client, "gemini://example.org/")
+	fetchString(t, client, "gemini://example.org/")
+
+	identity, err := GenerateClientCert("me", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Identities = map[string]*tls.Certificate{"example.org": &identity.Certificate}
+	fetchString(t, client, "gemini://example.org/")
+	fetchString(t, client, "gemini://example.org/")
+
+	requests := capsule.received()
+	if len(requests) != 2 || requests[0].Cert != nil || requests[1].Cert == nil {
+		t.Errorf("got %d requests, want one per identity", len(requests))
+	}
+}
+
+func TestClientCacheKnownHosts(t *testing.T) {
+	respond := byPath(map[string]string{"/": "20 text/gemini\r\n# hello\n"})
+	first, second := newTestCapsule(t, respond), newTestCapsule(t, respond)
+
+	known, _ := LoadKnownHosts("")
+	client := first.client()
+	client.Cache = &MemoryCache{}
+	client.KnownHosts = known
+	fetchString(t, client, "gemini://example.org/")
+
+	// the host moved to a new certificate, which the user trusted. the response cached
+	// with the old one mustn't be served anymore
+	known.Add("example.org", second.cert)
+	client.DialContext = second.dial
+	if resp, _ := fetchString(t, client, "gemini://example.org/"); resp.Fingerprint() != Fingerprint(second.cert) {
+		t.Error("got the response cached with the old certificate")
+	}
+
+	fetchString(t, client, "gemini://example.org/")
+	if requests := len(second.received()); requests != 1 {
+		t.Errorf("got %d requests, want the new response cached", requests)
+	}
+}
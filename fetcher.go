@@ -0,0 +1,116 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"sync"
+)
+
+/* ========================================[[ Fetchers ]]========================================= */
+
+// fetches gemini urls, implemented by Client. code that takes a Fetcher instead of a
+// *Client can be tested with a FakeFetcher, without a network or TLS
+type Fetcher interface {
+	Fetch(rawURL string) (*Response, error)
+	FetchContext(ctx context.Context, rawURL string) (*Response, error)
+}
+
+type fakeResponse struct {
+	status int
+	meta   string
+	body   []byte
+	err    error
+}
+
+// a Fetcher serving canned responses by url, for tests. redirects are followed like
+// Client does, and urls without a response get a 51 (not found). the zero value is ready
+// to use, eg:
+//
+//	fake := &gemini.FakeFetcher{}
+//	fake.Respond("gemini://example.org/", gemini.StatusSuccess, "text/gemini", "# hi\n")
+//	fake.Respond("gemini://example.org/old", gemini.StatusRedirectPerm, "/", "")
+//	crawler := &crawler.Crawler{Client: fake}
+type FakeFetcher struct {
+	mu        sync.Mutex
+	responses map[string]fakeResponse
+	requests  []string
+}
+
+// makes requests for rawURL get a response with status, meta & body
+func (fake *FakeFetcher) Respond(rawURL string, status int, meta, body string) {
+	fake.set(rawURL, fakeResponse{status: status, meta: meta, body: []byte(body)})
+}
+
+// makes requests for rawURL fail with err, eg. a *CertMismatchError
+func (fake *FakeFetcher) Fail(rawURL string, err error) {
+	fake.set(rawURL, fakeResponse{err: err})
+}
+
+func (fake *FakeFetcher) set(rawURL string, resp fakeResponse) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.responses == nil {
+		fake.responses = map[string]fakeResponse{}
+	}
+	fake.responses[rawURL] = resp
+}
+
+// returns the urls requested so far, in order. each redirect hop is a request of its own
+func (fake *FakeFetcher) Requests() []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return append([]string{}, fake.requests...)
+}
+
+func (fake *FakeFetcher) Fetch(rawURL string) (*Response, error) {
+	return fake.FetchContext(context.Background(), rawURL)
+}
+
+func (fake *FakeFetcher) FetchContext(ctx context.Context, rawURL string) (*Response, error) {
+	visited := map[string]bool{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, rawURL)
+		canned, exists := fake.responses[rawURL]
+		fake.mu.Unlock()
+
+		if !exists {
+			canned = fakeResponse{status: StatusNotFound, meta: "Not found"}
+		}
+		if canned.err != nil {
+			return nil, canned.err
+		}
+
+		resp := &Response{Status: canned.status, Meta: canned.meta, URL: rawURL}
+		resp.Body = io.NopCloser(bytes.NewReader(canned.body))
+		if !resp.IsRedirect() {
+			return resp, nil
+		}
+		visited[rawURL] = true
+
+		base, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		target, err := base.Parse(resp.Meta)
+		if err != nil {
+			return nil, err
+		}
+		rawURL = target.String()
+
+		switch {
+		case visited[rawURL]:
+			return nil, ErrRedirectLoop
+		case len(visited) > defaultMaxRedirects:
+			return nil, ErrTooManyRedirects
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+/* =======================================[[ ServeFile ]]======================================== */
+
+// sends the appropriate failure response for an error returned while opening a file (can panic !)
+func sendFileError(peer *GeminiPeer, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		peer.SendNotFound("File not found!")
+	} else {
+		peer.SendError("Failed to read file!")
+	}
+}
+
+// sends the success header for name and streams content to the peer (can panic !)
+func serveContent(peer *GeminiPeer, name string, content io.Reader) {
+	peer.SendSuccess(peer.server.mimeType(name), content)
+}
+
+// streams an already opened file to the peer, directories are reported as missing (can panic !)
+func serveFile(peer *GeminiPeer, name string, file fs.File) {
+	info, err := file.Stat()
+	if err != nil {
+		sendFileError(peer, err)
+		return
+	}
+
+	if info.IsDir() {
+		sendFileError(peer, fs.ErrNotExist)
+		return
+	}
+
+	serveContent(peer, name, file)
+}
+
+// opens the file at path on the local filesystem and streams it to the peer. missing
+// files (and directories) are reported with StatusNotFound, other errors with
+// StatusTemporaryFailure (can panic !)
+func ServeFile(peer *GeminiPeer, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		sendFileError(peer, err)
+		return
+	}
+	defer file.Close()
+
+	serveFile(peer, path, file)
+}
+
+/* =======================================[[ fileHandler ]]======================================= */
+
+// ordering used for generated directory listings
+type ListingOrder int
+
+const (
+	SortByName ListingOrder = iota
+	SortBySize
+	SortByModTime
+)
+
+type fileHandler struct {
+	fsys        fs.FS
+	indexFiles  []string
+	listDirs    bool
+	listOrder   ListingOrder
+	listReverse bool
+}
+
+// serves the files in fsys (eg. os.DirFS() or an embed.FS) using the request path
+// relative to the root of fsys
+func FileServer(fsys fs.FS) *fileHandler {
+	return &fileHandler{fsys: fsys, indexFiles: []string{"index.gmi", "index.gemini"}}
+}
+
+// maps a request path onto a name that fsys accepts. returns false if the path
+// would escape the root of fsys
+func fsName(reqPath string) (string, bool) {
+	name := path.Clean("/" + reqPath)
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "."
+	}
+
+	return name, fs.ValidPath(name)
+}
+
+// sets the file names (tried in order) that are served when a directory is requested.
+// defaults to "index.gmi", "index.gemini"
+func (fHndlr *fileHandler) SetIndexFiles(names ...string) {
+	fHndlr.indexFiles = names
+}
+
+// if enabled, directories without an index file are answered with a generated gemtext listing of their
+// entries. otherwise they're reported as missing (the default)
+func (fHndlr *fileHandler) SetDirListing(enabled bool) {
+	fHndlr.listDirs = enabled
+}
+
+// sets the order entries appear in for generated listings. if reverse is true the
+// order is flipped (eg. newest first for SortByModTime)
+func (fHndlr *fileHandler) SetListingOrder(order ListingOrder, reverse bool) {
+	fHndlr.listOrder = order
+	fHndlr.listReverse = reverse
+}
+
+func (fHndlr *fileHandler) ServeGemini(peer *GeminiPeer) {
+	name, ok := fsName(peer.path)
+	if !ok {
+		peer.SendNotFound("File not found!")
+		return
+	}
+
+	file, err := fHndlr.fsys.Open(name)
+	if err != nil {
+		sendFileError(peer, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		sendFileError(peer, err)
+		return
+	}
+
+	if info.IsDir() {
+		fHndlr.serveDir(peer, name)
+		return
+	}
+
+	serveContent(peer, name, file)
+}
+
+// escapes name for use as a relative link. url.PathEscape() leaves ':' alone, so a name
+// like "a:b" gets a "./" prefix to keep it from being read as a scheme
+func escapeName(name string) string {
+	link := url.PathEscape(name)
+	if strings.Contains(link, ":") {
+		link = "./" + link
+	}
+
+	return link
+}
+
+// serves the directory's index file, or a listing if there is none (can panic !)
+func (fHndlr *fileHandler) serveDir(peer *GeminiPeer, name string) {
+	// relative links inside the index only resolve correctly with a trailing slash
+	if !strings.HasSuffix(peer.path, "/") {
+		peer.SendPermanentRedirect(escapeName(path.Base(peer.path)) + "/")
+		return
+	}
+
+	for _, index := range fHndlr.indexFiles {
+		if fHndlr.serveIndex(peer, name, index) {
+			return
+		}
+	}
+
+	if !fHndlr.listDirs {
+		sendFileError(peer, fs.ErrNotExist)
+		return
+	}
+
+	fHndlr.sendListing(peer, name)
+}
+
+// serves the index file of the directory name, reports false if there's no such file
+// (can panic !)
+func (fHndlr *fileHandler) serveIndex(peer *GeminiPeer, name, index string) bool {
+	file, err := fHndlr.fsys.Open(path.Join(name, index))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		return false
+	}
+
+	serveContent(peer, index, file)
+	return true
+}
+
+// formats a file size for listings, eg. "12.3 KiB"
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func (fHndlr *fileHandler) sortEntries(infos []fs.FileInfo) {
+	less := func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		switch fHndlr.listOrder {
+		case SortBySize:
+			if a.Size() != b.Size() {
+				return a.Size() < b.Size()
+			}
+		case SortByModTime:
+			if !a.ModTime().Equal(b.ModTime()) {
+				return a.ModTime().Before(b.ModTime())
+			}
+		}
+
+		return a.Name() < b.Name()
+	}
+
+	if fHndlr.listReverse {
+		sort.SliceStable(infos, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(infos, less)
+	}
+}
+
+// generates and sends a gemtext listing of the directory name. hidden (dot) files
+// are skipped (can panic !)
+func (fHndlr *fileHandler) sendListing(peer *GeminiPeer, name string) {
+	entries, err := fs.ReadDir(fHndlr.fsys, name)
+	if err != nil {
+		sendFileError(peer, err)
+		return
+	}
+
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	fHndlr.sortEntries(infos)
+
+	// links are relative so the listing still works when mounted under a prefix
+	body := NewBody()
+	body.AddHeader("Index of " + peer.path)
+	if name != "." {
+		body.addLink("../", "..")
+	}
+
+	for _, info := range infos {
+		link := escapeName(info.Name())
+		text := info.Name()
+		if info.IsDir() {
+			link += "/"
+			text += "/"
+		} else {
+			text += " (" + formatSize(info.Size()) + ")"
+		}
+
+		text += " " + info.ModTime().UTC().Format("2006-01-02 15:04")
+		body.addLink(link, text)
+	}
+
+	peer.SendBody(body)
+}
+
+// same as ServeGemini(), can be passed to GeminiServer.Run()
+func (fHndlr *fileHandler) HandlePeer(peer *GeminiPeer) {
+	fHndlr.ServeGemini(peer)
+}
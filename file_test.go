@@ -0,0 +1,28 @@
+package gemini
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestListingEscapesNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a:b":         {Data: []byte("hi")},
+		"plain.gmi":   {Data: []byte("hi")},
+		"x:y/idx.gmi": {Data: []byte("hi")},
+	}
+
+	handler := FileServer(fsys)
+	handler.SetDirListing(true)
+	body := serveBody(handler, "/")
+	for _, want := range []string{"=> ./a:b a:b", "=> plain.gmi plain.gmi", "=> ./x:y/ x:y/"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("listing is missing '%s':\n%s", want, body)
+		}
+	}
+
+	checkRoutes(t, handler, []routeTest{
+		{"/x:y", "31 ./x:y/"},
+	})
+}
@@ -0,0 +1,390 @@
+package gemini
+
+import (
+	"html"
+	"strings"
+)
+
+/* =====================================[[ HTML to Gemtext ]]===================================== */
+
+type htmlToken struct {
+	tag     string // lowercased, "" for text
+	closing bool
+	attrs   map[string]string
+	text    string // still html-escaped
+}
+
+// elements whose contents aren't markup
+var htmlRawTextTags = map[string]bool{"script": true, "style": true}
+
+// elements whose text isn't part of the page's content
+var htmlSkipTags = map[string]bool{"head": true, "template": true, "noscript": true, "svg": true}
+
+// splits src into tags & text. it's forgiving rather than correct: comments, doctypes
+// and the contents of script & style elements are dropped, stray '<'s are kept as text
+func tokenizeHTML(src string) []htmlToken {
+	var tokens []htmlToken
+	for len(src) > 0 {
+		start := strings.IndexByte(src, '<')
+		if start == -1 {
+			tokens = append(tokens, htmlToken{text: src})
+			break
+		}
+		if start > 0 {
+			tokens = append(tokens, htmlToken{text: src[:start]})
+			src = src[start:]
+		}
+
+		switch {
+		case strings.HasPrefix(src, "<!--"):
+			end := strings.Index(src, "-->")
+			if end == -1 {
+				return tokens
+			}
+			src = src[end+3:]
+			continue
+		case strings.HasPrefix(src, "<!") || strings.HasPrefix(src, "<?"):
+			end := strings.IndexByte(src, '>')
+			if end == -1 {
+				return tokens
+			}
+			src = src[end+1:]
+			continue
+		}
+
+		token, rest, ok := parseHTMLTag(src)
+		if !ok {
+			tokens = append(tokens, htmlToken{text: "<"})
+			src = src[1:]
+			continue
+		}
+		tokens = append(tokens, token)
+		src = rest
+
+		// skip straight to the end of raw text elements
+		if htmlRawTextTags[token.tag] && !token.closing {
+			end := strings.Index(strings.ToLower(src), "</"+token.tag)
+			if end == -1 {
+				return tokens
+			}
+			src = src[end:]
+		}
+	}
+
+	return tokens
+}
+
+// parses the tag src starts with, returning the rest of src
+func parseHTMLTag(src string) (htmlToken, string, bool) {
+	token := htmlToken{attrs: map[string]string{}}
+	i := 1
+	if i < len(src) && src[i] == '/' {
+		token.closing = true
+		i++
+	}
+
+	start := i
+	for i < len(src) && (isASCIILetter(src[i]) || (i > start && src[i] >= '0' && src[i] <= '9')) {
+		i++
+	}
+	if i == start {
+		return token, src, false
+	}
+	token.tag = strings.ToLower(src[start:i])
+
+	// attributes, eg. href="..." or checked
+	for i < len(src) {
+		for i < len(src) && (src[i] == ' ' || src[i] == '\t' || src[i] == '\n' || src[i] == '\r' || src[i] == '/') {
+			i++
+		}
+		if i >= len(src) {
+			break
+		}
+		if src[i] == '>' {
+			return token, src[i+1:], true
+		}
+
+		nameStart := i
+		for i < len(src) && !strings.ContainsRune(" \t\r\n/>=", rune(src[i])) {
+			i++
+		}
+		name := strings.ToLower(src[nameStart:i])
+
+		value := ""
+		if i < len(src) && src[i] == '=' {
+			i++
+			if i < len(src) && (src[i] == '"' || src[i] == '\'') {
+				quote := src[i]
+				end := strings.IndexByte(src[i+1:], quote)
+				if end == -1 {
+					return token, src, false
+				}
+				value = src[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				valueStart := i
+				for i < len(src) && !strings.ContainsRune(" \t\r\n>", rune(src[i])) {
+					i++
+				}
+				value = src[valueStart:i]
+			}
+		}
+		token.attrs[name] = html.UnescapeString(value)
+	}
+
+	return token, src, false
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// elements that start (and end) a new block of text
+var htmlBlockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "header": true, "footer": true,
+	"main": true, "nav": true, "aside": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "ul": true, "ol": true, "li": true, "dl": true, "dt": true,
+	"dd": true, "blockquote": true, "table": true, "tr": true, "hr": true, "figure": true,
+	"figcaption": true, "form": true, "address": true, "details": true, "summary": true,
+}
+
+// converts html to gemtext
+type htmlConverter struct {
+	body  *GeminiBody
+	text  strings.Builder // text of the current block
+	links []pendingLink   // links of the current block (or list)
+
+	heading   int // level of the heading being converted, 0 if none
+	listDepth int
+	inItem    bool
+	quote     int
+	skip      int // depth of elements whose text is dropped (eg. head)
+
+	pre    int
+	preAlt string
+	preBuf strings.Builder
+
+	anchors []htmlAnchor // open <a> elements
+}
+
+type htmlAnchor struct {
+	href  string
+	start int // where the anchor's text starts in text
+}
+
+// appends text to the current block, collapsing whitespace like a browser would
+func (conv *htmlConverter) write(text string) {
+	if conv.pre > 0 {
+		conv.preBuf.WriteString(text)
+		return
+	}
+
+	fields := strings.FieldsFunc(text, isHTMLSpace)
+	if len(fields) == 0 {
+		if text != "" {
+			conv.space()
+		}
+		return
+	}
+
+	if isHTMLSpace(rune(text[0])) {
+		conv.space()
+	}
+	conv.text.WriteString(strings.Join(fields, " "))
+	if isHTMLSpace(rune(text[len(text)-1])) {
+		conv.space()
+	}
+}
+
+// separates what was written so far from what comes next
+func (conv *htmlConverter) space() {
+	if n := conv.text.Len(); n > 0 && conv.text.String()[n-1] != ' ' {
+		conv.text.WriteByte(' ')
+	}
+}
+
+func isHTMLSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f'
+}
+
+// emits the current block
+func (conv *htmlConverter) flush() {
+	text := strings.TrimSpace(conv.text.String())
+	conv.text.Reset()
+
+	if text != "" {
+		switch {
+		case conv.heading == 1:
+			conv.body.AddHeader(EscapeText(text))
+		case conv.heading == 2:
+			conv.body.AddSubHeader(EscapeText(text))
+		case conv.heading > 2:
+			conv.body.AddSubSubHeader(EscapeText(text))
+		case conv.inItem:
+			conv.body.AddListItem(text)
+		case conv.quote > 0:
+			conv.body.AddQuote(text)
+		default:
+			conv.body.AddTextLine(EscapeText(text))
+		}
+	}
+
+	// links are held back until the end of a list so they don't break it up
+	if conv.listDepth == 0 {
+		for _, link := range conv.links {
+			conv.body.AddSafeLinkLine(link.url, link.text)
+		}
+		conv.links = nil
+	}
+}
+
+func (conv *htmlConverter) addLink(href, text string) {
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return
+	}
+
+	if text = strings.TrimSpace(text); text == "" {
+		text = href
+	}
+	conv.links = append(conv.links, pendingLink{url: href, text: text})
+}
+
+func (conv *htmlConverter) openTag(token htmlToken) {
+	if htmlBlockTags[token.tag] {
+		conv.flush()
+	}
+
+	switch token.tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		conv.heading = int(token.tag[1] - '0')
+	case "ul", "ol":
+		conv.listDepth++
+	case "li":
+		conv.inItem = true
+	case "blockquote":
+		conv.quote++
+	case "br":
+		if conv.heading > 0 || conv.inItem {
+			conv.space()
+		} else {
+			conv.flush()
+		}
+	case "td", "th":
+		conv.space()
+	case "a":
+		conv.anchors = append(conv.anchors, htmlAnchor{href: token.attrs["href"], start: conv.text.Len()})
+	case "img":
+		alt := token.attrs["alt"]
+		conv.write(alt)
+		if len(conv.anchors) == 0 {
+			if alt == "" {
+				alt = "image"
+			}
+			conv.addLink(token.attrs["src"], alt)
+		}
+	case "pre":
+		conv.flush()
+		conv.pre++
+		conv.preAlt = ""
+	case "code":
+		// eg. <pre><code class="language-go">
+		if conv.pre > 0 {
+			for _, class := range strings.Fields(token.attrs["class"]) {
+				if lang := strings.TrimPrefix(class, "language-"); lang != class {
+					conv.preAlt = lang
+				}
+			}
+		}
+	}
+}
+
+func (conv *htmlConverter) closeTag(token htmlToken) {
+	switch token.tag {
+	case "a":
+		if n := len(conv.anchors); n > 0 {
+			anchor := conv.anchors[n-1]
+			conv.anchors = conv.anchors[:n-1]
+
+			text := conv.text.String()
+			if anchor.start <= len(text) {
+				conv.addLink(anchor.href, text[anchor.start:])
+			}
+		}
+		return
+	case "pre":
+		if conv.pre > 0 {
+			conv.pre--
+		}
+		if conv.pre == 0 {
+			code := strings.TrimPrefix(conv.preBuf.String(), "\n")
+			conv.preBuf.Reset()
+			conv.body.AddPreformatted(conv.preAlt, code)
+		}
+		return
+	}
+
+	if !htmlBlockTags[token.tag] {
+		return
+	}
+	conv.flush()
+
+	switch token.tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		conv.heading = 0
+	case "li":
+		conv.inItem = false
+	case "ul", "ol":
+		if conv.listDepth > 0 {
+			conv.listDepth--
+		}
+		if conv.listDepth == 0 {
+			conv.inItem = false
+			conv.body.AddRaw("\n")
+			conv.flush()
+		}
+	case "blockquote":
+		if conv.quote > 0 {
+			conv.quote--
+		}
+	}
+}
+
+// converts html to gemtext and adds it to the body. headings, paragraphs, lists, quotes
+// and preformatted text are kept (headings deeper than h3 are flattened to "###"),
+// everything else is reduced to its text. links & images become link lines after the
+// block they appear in (after the whole list for list items). the contents of head,
+// script & style elements are dropped
+func (body *GeminiBody) AddHTML(src string) {
+	conv := &htmlConverter{body: body}
+	for _, token := range tokenizeHTML(src) {
+		switch {
+		case token.tag == "":
+			if conv.skip == 0 {
+				conv.write(html.UnescapeString(token.text))
+			}
+		case htmlSkipTags[token.tag]:
+			if !token.closing {
+				conv.skip++
+			} else if conv.skip > 0 {
+				conv.skip--
+			}
+		case conv.skip > 0:
+		case token.closing:
+			conv.closeTag(token)
+		default:
+			conv.openTag(token)
+		}
+	}
+
+	conv.flush()
+	if conv.pre > 0 {
+		conv.body.AddPreformatted(conv.preAlt, strings.TrimPrefix(conv.preBuf.String(), "\n"))
+	}
+}
+
+// converts html to gemtext, see GeminiBody.AddHTML()
+func HTMLToGemtext(src string) string {
+	body := NewBody()
+	body.AddHTML(src)
+	return body.String()
+}
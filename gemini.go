@@ -6,54 +6,132 @@ extremely basic gemini server implementing the gemini protocol as described by:
 package gemini
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
 const (
 	StatusInput              = 10
+	StatusSensitiveInput     = 11
 	StatusSuccess            = 20
 	StatusRedirect           = 30
 	StatusRedirectTemp       = 30
 	StatusRedirectPerm       = 31
 	StatusTemporaryFailure   = 40
 	StatusUnavailable        = 41
+	StatusCGIError           = 42
+	StatusSlowDown           = 44
 	StatusPermanentFailure   = 50
 	StatusNotFound           = 51
+	StatusProxyRefused       = 53
 	StatusBadRequest         = 59
 	StatusClientCertRequired = 60
+	StatusCertNotAuthorized  = 61
+	StatusCertNotValid       = 62
 )
 
 type GeminiPeer struct {
-	server   *GeminiServer
-	sock     net.Conn
-	rawURL   string
-	hostname string
-	path     string
-	param    string
-	uri      string
-	params   map[string]string
+	server     *GeminiServer
+	sock       net.Conn
+	rawURL     string
+	hostname   string
+	path       string
+	param      string
+	uri        string
+	params     url.Values
+	pathParams map[string]string
+	route      *Route  // the route that matched, see pathHandler.Stats()
+	status     int     // status of the response header, 0 until it's sent
+	layout     *Layout // wraps bodies sent with SendBody(), see Layout.Middleware()
+	throttle   *tokenBucket
+	out        *bufio.Writer
+	capture    *bytes.Buffer
+	ctx        context.Context
+	cancel     context.CancelFunc
+	parent     *GeminiPeer // set for peers forked by WithTimeout(), writes go through it
+	mu         sync.Mutex  // guards writes, see WithTimeout()
+	sent       bool        // set once anything was written
+	abandoned  bool        // set once the handler timed out
+	closed     bool
+	close      sync.Once
 }
 
 type GeminiServer struct {
 	listenSock net.Listener
+	certPairs  []certPair
+	tlsConfig  atomic.Pointer[tls.Config]
+	handler    atomic.Pointer[Handler]
+	reloaders  []func(server *GeminiServer) error
+	workers    int
+	queueSize  int
+	rejecting  chan struct{}
+
+	// connections currently open, see Shutdown()
+	shuttingDown atomic.Bool
+	stopped      chan struct{}
+	stopOnce     sync.Once
+	active       sync.WaitGroup
+	peersMu      sync.Mutex
+	peers        map[*GeminiPeer]struct{}
+	draining     bool // set (under peersMu) once Shutdown() waits on active
+
+	// settings that can change at runtime (see Reload())
+	mu             sync.RWMutex
+	certs          []tls.Certificate
+	tlsMinVersion  uint16
+	tlsMaxVersion  uint16
+	cipherSuites   []uint16
+	curves         []tls.CurveID
+	mimeTypes      map[string]string
+	bandwidth      int
+	requestTimeout time.Duration
+	timeoutReply   bool
+	trustedProxies []*net.IPNet
 }
 
 type GeminiRequest struct {
 	sock           *tls.Conn
 	responseHeader string
-	responseBody   string
+	responseBody   []byte
 }
 
 /* ===================================[[ Helper Functions ]]==================================== */
 
-// (can panic !)
+// splits rawUrl into its scheme (eg. "gemini://"), hostname, percent-decoded path &
+// query (can panic !)
 func ParseURL(rawUrl string) (uri, hostname, path, param string) {
+	uri, hostname, path, param, err := parseURL(rawUrl)
+	if err != nil {
+		panic(err)
+	}
+
+	return
+}
+
+func parseURL(rawUrl string) (uri, hostname, path, param string, err error) {
+	// split off the parameter (if exists)
+	if i := strings.Index(rawUrl, "?"); i != -1 {
+		if param, err = url.QueryUnescape(rawUrl[i+1:]); err != nil {
+			return "", "", "", "", fmt.Errorf("failed to decode param: %w", err)
+		}
+		rawUrl = rawUrl[:i]
+	}
+
 	// clean url, parse out the uri
 	if i := strings.Index(rawUrl, "://"); i != -1 {
 		uri = rawUrl[:i+3]  // eg. "gemini://"
@@ -72,41 +150,141 @@ func ParseURL(rawUrl string) (uri, hostname, path, param string) {
 		path = "/"
 	}
 
-	// grab parameter (if exists)
-	if i := strings.Index(rawUrl, "?"); i != -1 {
-		// decode param
-		tparam, err := url.QueryUnescape(rawUrl[i+1:])
-		if err != nil {
-			panic("failed to decode param!")
-		}
+	if path, err = url.PathUnescape(path); err != nil {
+		return "", "", "", "", fmt.Errorf("failed to decode path: %w", err)
+	}
 
-		// decode path
-		tpath, err := url.PathUnescape(rawUrl[:i])
-		if err != nil {
-			panic("failed to decode path!")
+	return
+}
+
+// normalizes a (percent-decoded) request path: duplicate slashes are collapsed and "." &
+// ".." segments resolved, eg. "/a//b/../c/" -> "/a/c/". a trailing slash is kept. returns
+// false if a ".." segment would climb above the root
+func NormalizePath(reqPath string) (string, bool) {
+	segments := strings.Split(reqPath, "/")
+	clean := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		switch segment {
+		case "", ".":
+		case "..":
+			if len(clean) == 0 {
+				return "", false
+			}
+			clean = clean[:len(clean)-1]
+		default:
+			clean = append(clean, segment)
 		}
+	}
 
-		// set
-		param = tparam
-		path = tpath
+	normalized := "/" + strings.Join(clean, "/")
+	if last := segments[len(segments)-1]; len(clean) > 0 && (last == "" || last == "." || last == "..") {
+		normalized += "/"
 	}
+	return normalized, true
+}
 
-	return
+// reports whether s contains any ASCII control characters
+func hasControl(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return r < 0x20 || r == 0x7f
+	}) != -1
+}
+
+// parses a raw (still percent-encoded) query. "a=1&b=2" style queries are split into their
+// keys, anything else (eg. a bare input string) is stored whole under the "" key
+func parseQuery(rawQuery string) url.Values {
+	values := url.Values{}
+	if rawQuery == "" {
+		return values
+	}
+
+	if !strings.Contains(rawQuery, "=") {
+		if input, err := url.QueryUnescape(rawQuery); err == nil {
+			values.Set("", input)
+		}
+		return values
+	}
+
+	// malformed pairs are skipped, the rest are kept
+	values, _ = url.ParseQuery(rawQuery)
+	return values
 }
 
 /* ======================================[[ GeminiPeer ]]======================================= */
 
+// returns nil if the server is shutting down, the connection should be dropped then
 func (server *GeminiServer) newPeer(sock net.Conn) *GeminiPeer {
-	return &GeminiPeer{server: server, sock: sock}
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	peer := &GeminiPeer{server: server, sock: sock, out: bufio.NewWriter(sock)}
+	if !server.track(peer) {
+		return nil
+	}
+
+	peer.ctx, peer.cancel = context.WithCancel(context.Background())
+	peer.SetBandwidthLimit(server.bandwidth)
+	return peer
 }
 
+// how long a closed connection lingers (in the background) for the peer to hang up
+const closeLinger = time.Second
+
+// closes the connection, meant to be deferred since it also recovers (and logs) panics
 func (peer *GeminiPeer) Kill() {
 	// catch any panics
 	if r := recover(); r != nil {
 		log.Printf("%s [ERR]: %s", peer.GetAddr(), r)
 	}
 
+	peer.Close()
+}
+
+// flushes pending writes, sends a TLS close_notify and closes the connection. safe to
+// call multiple times, including from handlers
+func (peer *GeminiPeer) Close() {
+	if peer.parent != nil {
+		peer.parent.Close()
+		return
+	}
+
+	peer.close.Do(func() {
+		peer.mu.Lock()
+		peer.closed = true
+		peer.out.Flush()
+		peer.mu.Unlock()
+
+		if peer.cancel != nil {
+			peer.cancel()
+		}
+
+		// let the peer know the response is complete, then give it a moment to hang
+		// up first. closing with unread data pending makes the kernel send a RST,
+		// which can make the peer discard the tail of the response
+		if tlsConn, ok := peer.sock.(*tls.Conn); ok && tlsConn.CloseWrite() == nil {
+			if rawConn, ok := tlsConn.NetConn().(interface{ CloseWrite() error }); ok {
+				rawConn.CloseWrite()
+			}
+
+			// linger in the background, so slow (or rude) peers don't hold up a worker
+			go func() {
+				peer.sock.SetReadDeadline(time.Now().Add(closeLinger))
+				io.Copy(io.Discard, peer.sock)
+				peer.release()
+			}()
+			return
+		}
+
+		peer.release()
+	})
+}
+
+// closes the socket and lets the server forget about the peer
+func (peer *GeminiPeer) release() {
 	peer.sock.Close()
+	if peer.server != nil {
+		peer.server.untrack(peer)
+	}
 }
 
 // returns number of bytes read into p (can panic!)
@@ -120,12 +298,40 @@ func (peer *GeminiPeer) Read(p []byte) int {
 	return sz
 }
 
-// writes bytes to tls connection (can panic !)
+// writes bytes to tls connection, respecting the peer's bandwidth limit. writes are
+// buffered, see Flush() (can panic !)
 func (peer *GeminiPeer) Write(p []byte) {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+
+	if peer.abandoned {
+		panic("write after the handler timed out!")
+	}
+	if peer.parent != nil {
+		peer.forward(p)
+		return
+	}
+	peer.write(p)
+}
+
+// same as Write(), peer.mu must be held (can panic !)
+func (peer *GeminiPeer) write(p []byte) {
 	written := 0
 
+	if peer.closed {
+		panic("write to closed peer!")
+	}
+
 	for written < len(p) {
-		sz, err := peer.sock.Write(p[written:])
+		chunk := p[written:]
+		if peer.throttle != nil {
+			if len(chunk) > throttleChunkSize {
+				chunk = chunk[:throttleChunkSize]
+			}
+			peer.throttle.wait(len(chunk))
+		}
+
+		sz, err := peer.out.Write(chunk)
 		if err != nil {
 			panic(err)
 		}
@@ -135,17 +341,80 @@ func (peer *GeminiPeer) Write(p []byte) {
 			panic("premature socket hangup!")
 		}
 
+		if peer.capture != nil {
+			peer.capture.Write(chunk[:sz])
+		}
+		peer.sent = true
 		written += sz
 	}
 }
 
+// sends any buffered writes to the peer (can panic !)
+func (peer *GeminiPeer) Flush() {
+	if peer.parent != nil {
+		peer.parent.Flush()
+		return
+	}
+
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+
+	if err := peer.out.Flush(); err != nil {
+		panic(err)
+	}
+}
+
+// size of the chunks used when streaming bodies to a peer
+const copyChunkSize = 32 * 1024
+
+// buffers shared between peers for streaming bodies
+var copyBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, copyChunkSize)
+		return &buf
+	},
+}
+
+// adapts GeminiPeer to io.Writer. since peer.Write panics on failure, Write
+// here only ever reports success
+type peerWriter struct {
+	peer *GeminiPeer
+}
+
+func (w peerWriter) Write(p []byte) (int, error) {
+	w.peer.Write(p)
+	return len(p), nil
+}
+
+// reads the request line, which must arrive in full within the server's request
+// timeout (can panic !)
 func (peer *GeminiPeer) readRequest() {
 	buf := make([]byte, 1026)
 	length := 0
 
+	peer.server.mu.RLock()
+	timeout, timeoutReply := peer.server.requestTimeout, peer.server.timeoutReply
+	peer.server.mu.RUnlock()
+
+	if timeout > 0 {
+		peer.sock.SetReadDeadline(time.Now().Add(timeout))
+		defer peer.sock.SetReadDeadline(time.Time{})
+	}
+
 	// requests absolute url cannot be longer than 1024 bytes + <CR><LF> (2 bytes)
 	for length < 1026 {
-		sz := peer.Read(buf[length:])
+		sz, err := peer.sock.Read(buf[length:])
+		if err != nil {
+			// peer is trickling its request, drop it
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				if timeoutReply {
+					peer.sendHeader(StatusBadRequest, "Request timed out!")
+				}
+				panic("request timed out!")
+			}
+
+			panic(err)
+		}
 
 		// socket hangup (missing <CR><LF>)
 		if sz == 0 {
@@ -163,44 +432,270 @@ func (peer *GeminiPeer) readRequest() {
 	peer.rawURL = string(buf[:length-2])
 
 	// parse url
-	peer.uri, peer.hostname, peer.path, peer.param = ParseURL(peer.rawURL)
+	var err error
+	peer.uri, peer.hostname, peer.path, peer.param, err = parseURL(peer.rawURL)
+	if err != nil {
+		peer.sendHeader(StatusBadRequest, "Malformed request url!")
+		panic(err)
+	}
+
+	// a decoded CR, LF or NUL would end up in routing, logs, metas & CGI/SCGI variables
+	if hasControl(peer.rawURL) || hasControl(peer.path) {
+		peer.sendHeader(StatusBadRequest, "Request url contains control characters!")
+		panic("request url contains control characters!")
+	}
+
+	// resolve the path before it's routed, so eg. "/a/../b" can't sneak past a handler for "/b"
+	var ok bool
+	if peer.path, ok = NormalizePath(peer.path); !ok {
+		peer.sendHeader(StatusBadRequest, "Request path escapes the root!")
+		panic("request path escapes the root!")
+	}
+	peer.params = parseQuery(peer.rawQuery())
+}
+
+// meta can't be longer than 1024 bytes
+const maxMetaSize = 1024
+
+// makes meta safe to send: control characters (which could split the header) are
+// replaced with spaces & it's cut to maxMetaSize bytes
+func cleanMeta(meta string) string {
+	meta = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, meta)
+
+	if len(meta) > maxMetaSize {
+		return shortenText(meta, maxMetaSize)
+	}
+	return meta
+}
+
+// cuts text to at most size bytes (on a rune boundary), marking the cut with "..."
+func shortenText(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+
+	cut := size - len("...")
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "..."
 }
 
 func (peer *GeminiPeer) sendHeader(status int, meta string) {
+	meta = cleanMeta(meta)
+
 	// <STATUS><SPACE><META><CR><LF>
 	peer.Write([]byte(fmt.Sprintf("%d %s\r\n", status, meta)))
+	peer.logStatus(status, meta)
+}
 
-	log.Printf("%s <- STATUS %d '%s'", peer.GetAddr(), status, meta)
+// logs the response header sent to the peer, tagged with the name of the route that
+// handled it (if it has one)
+func (peer *GeminiPeer) logStatus(status int, meta string) {
+	if peer.status == 0 {
+		peer.status = status
+	}
+	if peer.parent != nil {
+		peer.parent.setStatus(status)
+	}
+
+	if peer.route != nil && peer.route.Name != "" {
+		log.Printf("%s <- STATUS %d '%s' [%s]", peer.GetAddr(), status, meta, peer.route.Name)
+	} else {
+		log.Printf("%s <- STATUS %d '%s'", peer.GetAddr(), status, meta)
+	}
 }
 
 func (peer *GeminiPeer) GetAddr() string {
 	return peer.sock.RemoteAddr().String()
 }
 
+// returns the state of the peer's TLS connection (negotiated version, cipher suite, SNI,
+// client certificates, etc.) or nil if the peer isn't connected over TLS
+func (peer *GeminiPeer) TLSState() *tls.ConnectionState {
+	tlsConn, ok := peer.sock.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+// returns the certificate the peer presented, or nil if it didn't present one
+func (peer *GeminiPeer) ClientCert() *x509.Certificate {
+	state := peer.TLSState()
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return state.PeerCertificates[0]
+}
+
+// returns the hostname the peer requested (as it appears in the request url)
+func (peer *GeminiPeer) GetHostname() string {
+	return peer.hostname
+}
+
+// returns the path the peer requested
+func (peer *GeminiPeer) GetPath() string {
+	return peer.path
+}
+
+// resolves target (eg. "../index.gmi" or "?page=2") against the url the peer requested,
+// returning an absolute url. targets that already are absolute, or that fail to parse, are
+// returned as-is
+func (peer *GeminiPeer) ResolveLink(target string) string {
+	ref, err := url.Parse(target)
+	if err != nil || ref.IsAbs() {
+		return target
+	}
+
+	base := &url.URL{Scheme: strings.TrimSuffix(peer.uri, "://"), Host: peer.hostname, Path: peer.path}
+	return base.ResolveReference(ref).String()
+}
+
+// returns the value of the named parameter captured by the route that matched the
+// request (eg. "id" for "/user/:id"), or "" if there is none
+func (peer *GeminiPeer) PathParam(name string) string {
+	return peer.pathParams[name]
+}
+
+// returns the route that matched the request, or nil if none did
+func (peer *GeminiPeer) Route() *Route {
+	return peer.route
+}
+
 // returns (param, isParam). if isParam is false, the peer did not post any parameter data
 func (peer *GeminiPeer) GetParam() (string, bool) {
 	return peer.param, strings.Compare(peer.param, "") != 0
 }
 
+// returns the peer's parsed query. a bare input string (eg. the answer to SendInput) is
+// stored under the "" key
+func (peer *GeminiPeer) Query() url.Values {
+	if peer.params == nil {
+		return url.Values{}
+	}
+
+	return peer.params
+}
+
+// returns the first value for key in the peer's query, or "" if there is none
+func (peer *GeminiPeer) QueryValue(key string) string {
+	return peer.params.Get(key)
+}
+
 // meta is the text that is prompted for the user (can panic !)
 func (peer *GeminiPeer) SendInput(meta string) {
 	peer.sendHeader(StatusInput, meta)
 }
 
+// same as SendInput(), but asks the client not to echo what the user types, eg. for
+// passwords (can panic !)
+func (peer *GeminiPeer) SendSensitiveInput(meta string) {
+	peer.sendHeader(StatusSensitiveInput, meta)
+}
+
 // meta is the text that is reported to the user (can panic !)
 func (peer *GeminiPeer) SendError(meta string) {
 	peer.sendHeader(StatusTemporaryFailure, meta)
 }
 
+// tells the peer to wait seconds before making another request (can panic !)
+func (peer *GeminiPeer) SendSlowDown(seconds int) {
+	peer.sendHeader(StatusSlowDown, strconv.Itoa(seconds))
+}
+
+// meta is the text that is reported to the user (can panic !)
+func (peer *GeminiPeer) SendNotFound(meta string) {
+	peer.sendHeader(StatusNotFound, meta)
+}
+
+// encodes target so it's safe to place in a response header (can panic !)
+func encodeRedirect(target string) string {
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil {
+		panic(fmt.Errorf("bad redirect target: %s", err))
+	}
+
+	return u.String()
+}
+
+// sends a StatusRedirectTemp response pointing the peer to target (can panic !)
+func (peer *GeminiPeer) SendRedirect(target string) {
+	peer.sendHeader(StatusRedirectTemp, encodeRedirect(target))
+}
+
+// sends a StatusRedirectPerm response pointing the peer to target (can panic !)
+func (peer *GeminiPeer) SendPermanentRedirect(target string) {
+	peer.sendHeader(StatusRedirectPerm, encodeRedirect(target))
+}
+
 // sends a StatusSuccess response header and the body (can panic !)
 func (peer *GeminiPeer) SendBody(body *GeminiBody) {
-	peer.sendHeader(StatusSuccess, "text/gemini")
-	peer.Write([]byte(body.buf))
+	peer.SendBodyLang(body, "")
+}
+
+// same as SendBody(), with the body labeled as written in lang, a BCP47 language tag or a
+// comma separated list of them (eg. "en" or "en,fr"). characters that can't appear in a
+// tag are dropped, and an empty lang leaves the body unlabeled (can panic !)
+func (peer *GeminiPeer) SendBodyLang(body *GeminiBody, lang string) {
+	lang = strings.Map(func(r rune) rune {
+		if (r < 0x80 && isASCIILetter(byte(r))) || (r >= '0' && r <= '9') || r == '-' || r == ',' {
+			return r
+		}
+		return -1
+	}, lang)
+
+	if peer.layout != nil {
+		body = peer.layout.Wrap(body)
+	}
+
+	mime := "text/gemini"
+	if lang != "" {
+		mime += "; lang=" + lang
+	}
+
+	peer.sendHeader(StatusSuccess, mime)
+	body.WriteTo(peerWriter{peer})
+}
+
+// sends a StatusSuccess response header with the given mime type and copies body
+// to the peer until EOF in copyChunkSize chunks, so large bodies (eg. files) are
+// never held in memory all at once (can panic !)
+func (peer *GeminiPeer) SendSuccess(mime string, body io.Reader) {
+	peer.sendHeader(StatusSuccess, mime)
+
+	buf := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(buf)
+
+	// wrapping body hides any WriterTo implementation (eg. *os.File), which
+	// would otherwise make io.CopyBuffer ignore our buffer and allocate its own
+	if _, err := io.CopyBuffer(peerWriter{peer}, struct{ io.Reader }{body}, *buf); err != nil {
+		panic(err)
+	}
+}
+
+// sends a StatusSuccess response header with the given mime type and returns a
+// writer that streams directly to the peer. writes to it can panic, same as
+// peer.Write(). use peer.Flush() to push out partial output early (can panic !)
+func (peer *GeminiPeer) BodyWriter(mime string) io.Writer {
+	peer.sendHeader(StatusSuccess, mime)
+	return peerWriter{peer}
 }
 
 /* =====================================[[ GeminiRequest ]]===================================== */
 
-// make a gemini request
+// make a gemini request. path & param are percent-encoded as they're written: path as
+// url.URL.EscapedPath() would (so '/' separates segments, and "%" is escaped too), param
+// with url.PathEscape(), which escapes ' ', '?' & '#' but leaves '=' & '&' alone so
+// "key=value&..." params keep their meaning
 func NewRequest(uri, hostname, port, path, param string) (req *GeminiRequest, err error) {
 	config := tls.Config{
 		ServerName:         hostname,
@@ -208,7 +703,7 @@ func NewRequest(uri, hostname, port, path, param string) (req *GeminiRequest, er
 	}
 
 	// open tcp connection to gemini server
-	conn, err := net.Dial("tcp", hostname+":"+port)
+	conn, err := net.Dial("tcp", net.JoinHostPort(hostname, port))
 	if err != nil {
 		return nil, err
 	}
@@ -226,13 +721,13 @@ func NewRequest(uri, hostname, port, path, param string) (req *GeminiRequest, er
 		}
 	}()
 
-	// write request
-	req.Write([]byte(fmt.Sprintf("%s%s%s", uri, hostname, path)))
-
-	// write parameter (if exists)
+	// write request (with the parameter, if it exists)
+	builder := NewURL(hostname).Scheme(strings.TrimSuffix(uri, "://"))
+	builder.RawPath((&url.URL{Path: path}).EscapedPath())
 	if len(param) > 0 {
-		req.Write([]byte(fmt.Sprintf("?%s", param)))
+		builder.RawQuery(url.PathEscape(param))
 	}
+	req.Write([]byte(builder.String()))
 
 	// write request terminator
 	req.Write([]byte("\r\n"))
@@ -249,14 +744,19 @@ func NewRequest(uri, hostname, port, path, param string) (req *GeminiRequest, er
 	return req, nil
 }
 
+// fetches url with DefaultClient, returning the body of the response
 func LazyRequest(url string) (result string, err error) {
-	uri, hostname, path, param := ParseURL(url)
-	req, err := NewRequest(uri, hostname, "1965", path, param)
+	resp, err := DefaultClient.Fetch(url)
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 
-	return req.responseBody, nil
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
 }
 
 // simple wrapper to write raw data over the tls connection (can panic !)
@@ -304,18 +804,20 @@ func (req *GeminiRequest) readHeaders() {
 		sz := req.Read(buf[length:])
 		// socket hangup (missing <CR><LF>)
 		if sz == 0 {
-			panic("malformed gemini response!")
+			panic(errors.New("malformed gemini response!"))
 		}
 
 		length += sz
-		// response headers end with a <CR><LF>
-		if length > 2 && buf[length-2] == '\r' && buf[length-1] == '\n' {
-			break
+		// response headers end with a <CR><LF>, the same read may have returned the start
+		// of the body too
+		if end := bytes.Index(buf[:length], []byte("\r\n")); end != -1 {
+			req.responseHeader = string(buf[:end])
+			req.responseBody = append(req.responseBody, buf[end+2:length]...)
+			return
 		}
 	}
 
-	// save response header
-	req.responseHeader = string(buf[:length-2])
+	panic(errors.New("malformed gemini response!"))
 }
 
 // reads gemini response body (can panic!)
@@ -327,39 +829,83 @@ func (req *GeminiRequest) readBody() {
 	for sz != 0 {
 		sz = req.Read(buf)
 
-		// append read data into body
-		req.responseBody += string(buf[0:])
+		// append only what was read, the body may be binary (eg. an image)
+		req.responseBody = append(req.responseBody, buf[:sz]...)
 	}
 }
 
+// returns the response header, eg. "20 text/gemini"
+func (req *GeminiRequest) Header() string {
+	return req.responseHeader
+}
+
+// returns the response body, as-is (it may be binary)
+func (req *GeminiRequest) Body() []byte {
+	return req.responseBody
+}
+
+// returns a reader over the response body
+func (req *GeminiRequest) BodyReader() io.Reader {
+	return bytes.NewReader(req.responseBody)
+}
+
 /* =====================================[[ GeminiServer ]]====================================== */
 
+// default time peers have to send their request, see SetRequestTimeout()
+const defaultRequestTimeout = 10 * time.Second
+
 func NewServer(port, certFile, keyFile string) (*GeminiServer, error) {
+	server := &GeminiServer{
+		certPairs:      []certPair{{certFile, keyFile}},
+		tlsMinVersion:  tls.VersionTLS12,
+		requestTimeout: defaultRequestTimeout,
+		stopped:        make(chan struct{}),
+	}
+
 	// load key pair && create config
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
+	if err := server.loadCertificates(); err != nil {
 		return nil, err
 	}
+
+	// handshakes always use the latest config, so it can be swapped by Reload()
 	config := tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return server.tlsConfig.Load(), nil
+		},
 	}
 
 	// create listener socket
 	log.Printf("listening on port %s\n", port)
-	l, err := tls.Listen("tcp", ":"+port, &config)
+	l, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		return nil, err
 	}
 
-	return &GeminiServer{listenSock: l}, nil
+	server.listenSock = tls.NewListener(&proxyListener{Listener: l, server: server}, &config)
+	return server, nil
+}
+
+// sets how long peers have to send their complete request (the TLS handshake
+// included), peers that take longer are disconnected. if reply is true they are
+// sent a StatusBadRequest first. a timeout of 0 disables the limit
+func (server *GeminiServer) SetRequestTimeout(timeout time.Duration, reply bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.requestTimeout = timeout
+	server.timeoutReply = reply
+}
+
+// replaces the handler used for new requests, can be called while the server is running
+func (server *GeminiServer) SetHandler(handler Handler) {
+	server.handler.Store(&handler)
 }
 
 // wrapper that reads the peer's request and dispatches the user-defined
 // request handler. also has some simple error recovery for cleaning up the
 // socket. request handlers are encouraged to use panic() if there is a
 // non-peer related error. for request-related errors, use peer.SendError()
-func (server *GeminiServer) handlePeer(peer *GeminiPeer, handler func(peer *GeminiPeer)) {
+func (server *GeminiServer) handlePeer(peer *GeminiPeer) {
 	defer peer.Kill()
 	peer.readRequest()
 
@@ -367,20 +913,108 @@ func (server *GeminiServer) handlePeer(peer *GeminiPeer, handler func(peer *Gemi
 	log.Printf("%s -> %s", peer.GetAddr(), peer.rawURL)
 
 	// call our user-defined peer handler
-	handler(peer)
+	handler := *server.handler.Load()
+	handler.ServeGemini(peer)
+}
+
+// instead of a goroutine per connection, handle connections with a fixed pool of
+// workers fed by a queue of at most queueSize pending connections. connections
+// accepted while the queue is full are told to slow down (or dropped if there are
+// too many of those too). should be called before Run(), the
+// pool isn't resized by Reload()
+func (server *GeminiServer) SetWorkerPool(workers, queueSize int) {
+	server.workers = workers
+	server.queueSize = queueSize
 }
 
+// starts the worker pool, returns the queue feeding it
+func (server *GeminiServer) startWorkers() chan *GeminiPeer {
+	server.rejecting = make(chan struct{}, maxRejecting)
+	queue := make(chan *GeminiPeer, server.queueSize)
+	for i := 0; i < server.workers; i++ {
+		go func() {
+			for peer := range queue {
+				server.handlePeer(peer)
+			}
+		}()
+	}
+
+	return queue
+}
+
+// same as Serve(), for plain functions
 func (server *GeminiServer) Run(peerRequest func(peer *GeminiPeer)) {
+	server.Serve(HandlerFunc(peerRequest))
+}
+
+// accepts connections, dispatching their requests to handler until the server is shut
+// down (see Shutdown())
+func (server *GeminiServer) Serve(handler Handler) {
+	server.SetHandler(handler)
+
+	var queue chan *GeminiPeer
+	if server.workers > 0 {
+		queue = server.startWorkers()
+	}
+
 	for {
 		// block and wait until tls socket connects
 		conn, err := server.listenSock.Accept()
 		if err != nil {
+			if server.shuttingDown.Load() {
+				if queue != nil {
+					close(queue)
+				}
+
+				<-server.stopped
+				return
+			}
+
 			log.Print("Listener socket: ", err)
 			continue
 		}
 
 		// create peer and handle connection
 		peer := server.newPeer(conn)
-		go server.handlePeer(peer, peerRequest)
+		if peer == nil {
+			conn.Close()
+			continue
+		}
+		if queue == nil {
+			go server.handlePeer(peer)
+			continue
+		}
+
+		select {
+		case queue <- peer:
+		default:
+			server.reject(peer)
+		}
 	}
 }
+
+// how many peers can be told to slow down at once while the worker queue is full
+const maxRejecting = 64
+
+// seconds peers are told to wait while the worker queue is full
+const busyRetrySeconds = 5
+
+// answers a peer that couldn't be queued with StatusSlowDown
+func (server *GeminiServer) reject(peer *GeminiPeer) {
+	select {
+	case server.rejecting <- struct{}{}:
+	default:
+		log.Printf("%s [ERR]: worker queue full, dropping connection", peer.GetAddr())
+		peer.Close()
+		return
+	}
+
+	go func() {
+		defer func() { <-server.rejecting }()
+		defer peer.Kill()
+
+		// don't let a slow peer hold on to this slot
+		peer.sock.SetDeadline(time.Now().Add(closeLinger))
+		peer.SendSlowDown(busyRetrySeconds)
+	}()
+}
@@ -0,0 +1,116 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		rawURL   string
+		hostname string
+		path     string
+		param    string
+	}{
+		{"gemini://localhost", "localhost", "/", ""},
+		{"gemini://localhost/a%20b/c", "localhost", "/a b/c", ""},
+		{"gemini://localhost/search?Jo+Smith", "localhost", "/search", "Jo Smith"},
+		{"gemini://localhost/search?a%2Bb%20c", "localhost", "/search", "a+b c"},
+		{"localhost:1965/a+b?x", "localhost:1965", "/a+b", "x"},
+	}
+
+	for _, test := range tests {
+		_, hostname, path, param := ParseURL(test.rawURL)
+		if hostname != test.hostname || path != test.path || param != test.param {
+			t.Errorf("%s: got (%s, %s, %s), want (%s, %s, %s)", test.rawURL, hostname, path, param, test.hostname, test.path, test.param)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	if input := parseQuery("Jo+Smith%21").Get(""); input != "Jo Smith!" {
+		t.Errorf("got '%s', want 'Jo Smith!'", input)
+	}
+
+	values := parseQuery("name=Jo+Smith&tag=a&tag=b")
+	if values.Get("name") != "Jo Smith" || len(values["tag"]) != 2 {
+		t.Errorf("got %v", values)
+	}
+}
+
+// sends raw (a request line, without the <CR><LF>) to a bare server, returning the
+// response header it got and the path the request was routed with
+func sendRequest(raw string) (header, reqPath string) {
+	client, conn := net.Pipe()
+	peer := &GeminiPeer{server: &GeminiServer{}, sock: conn, out: bufio.NewWriter(conn)}
+	peer.ctx, peer.cancel = context.WithCancel(context.Background())
+
+	response := make(chan string)
+	go func() {
+		client.Write([]byte(raw + "\r\n"))
+		line, _ := io.ReadAll(client)
+		header, _, _ := strings.Cut(string(line), "\r\n")
+		response <- header
+	}()
+
+	func() {
+		defer peer.Kill()
+		peer.readRequest()
+	}()
+	return <-response, peer.path
+}
+
+func TestReadRequest(t *testing.T) {
+	tests := []struct {
+		raw    string
+		header string
+		path   string
+	}{
+		{"gemini://localhost/a/../b%20c", "", "/b c"},
+		{"gemini://localhost/../etc", "59 Request path escapes the root!", ""},
+		{"gemini://localhost/a%0Ab", "59 Request url contains control characters!", ""},
+		{"gemini://localhost/%00TLS_CLIENT_HASH%00x", "59 Request url contains control characters!", ""},
+		{"gemini://localhost/a%0D%0A20 text/gemini", "59 Request url contains control characters!", ""},
+		{"gemini://localhost/a\x00b", "59 Request url contains control characters!", ""},
+		{"gemini://localhost/search?line%0Aanother", "", "/search"}, // input may span lines
+	}
+
+	for _, test := range tests {
+		header, reqPath := sendRequest(test.raw)
+		if header != test.header {
+			t.Errorf("%q: got '%s', want '%s'", test.raw, header, test.header)
+		}
+		if test.path != "" && reqPath != test.path {
+			t.Errorf("%q: routed as '%s', want '%s'", test.raw, reqPath, test.path)
+		}
+	}
+}
+
+func TestNewRequestEscaping(t *testing.T) {
+	capsule := newTestCapsule(t, byPath(map[string]string{}))
+	host, port, _ := net.SplitHostPort(capsule.listener.Addr().String())
+
+	tests := []struct {
+		path  string
+		param string
+		want  string
+	}{
+		{"/", "", "gemini://" + host + "/"},
+		{"/a b/ü", "", "gemini://" + host + "/a%20b/%C3%BC"},
+		{"/search", "why? #1 fan", "gemini://" + host + "/search?why%3F%20%231%20fan"},
+		{"/search", "q=a b&lang=en", "gemini://" + host + "/search?q=a%20b&lang=en"},
+	}
+
+	for i, test := range tests {
+		if _, err := NewRequest("gemini://", host, port, test.path, test.param); err != nil {
+			t.Fatal(err)
+		}
+		if got := capsule.received()[i].URL; got != test.want {
+			t.Errorf("%s ? %s: sent '%s', want '%s'", test.path, test.param, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package gemini
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+/* =====================================[[ Gemtext Parser ]]====================================== */
+
+// a line (or, for preformatted text, a block of lines) of a text/gemini document, see
+// ParseGemtext()
+type GemtextLine interface {
+	// the 1-based line number the line starts at
+	Position() int
+	// renders the line back to gemtext, without the trailing newline
+	String() string
+}
+
+type TextLine struct {
+	Pos  int
+	Text string
+}
+
+type LinkLine struct {
+	Pos  int
+	URL  string
+	Text string // "" if the link has no name
+}
+
+type HeadingLine struct {
+	Pos   int
+	Level int // 1 - 3
+	Text  string
+}
+
+type ListItemLine struct {
+	Pos  int
+	Text string
+}
+
+type QuoteLine struct {
+	Pos  int
+	Text string
+}
+
+// the lines between two "```" toggle lines. EndPos is the line number of the closing
+// toggle, or the last line of the document if the block was never closed
+type PreformattedBlock struct {
+	Pos    int
+	EndPos int
+	Alt    string
+	Lines  []string
+}
+
+func (line *TextLine) Position() int           { return line.Pos }
+func (line *LinkLine) Position() int           { return line.Pos }
+func (line *HeadingLine) Position() int        { return line.Pos }
+func (line *ListItemLine) Position() int       { return line.Pos }
+func (line *QuoteLine) Position() int          { return line.Pos }
+func (block *PreformattedBlock) Position() int { return block.Pos }
+
+func (line *TextLine) String() string {
+	return line.Text
+}
+
+func (line *LinkLine) String() string {
+	if line.Text == "" {
+		return "=> " + line.URL
+	}
+	return "=> " + line.URL + " " + line.Text
+}
+
+func (line *HeadingLine) String() string {
+	return strings.Repeat("#", line.Level) + " " + line.Text
+}
+
+func (line *ListItemLine) String() string {
+	return "* " + line.Text
+}
+
+func (line *QuoteLine) String() string {
+	return "> " + line.Text
+}
+
+func (block *PreformattedBlock) String() string {
+	var sb strings.Builder
+	sb.WriteString("```" + block.Alt + "\n")
+	for _, line := range block.Lines {
+		sb.WriteString(line + "\n")
+	}
+	sb.WriteString("```")
+	return sb.String()
+}
+
+// parses a single line outside of a preformatted block
+func parseGemtextLine(pos int, line string) GemtextLine {
+	switch {
+	case strings.HasPrefix(line, "=>"):
+		fields := strings.Fields(line[2:])
+		if len(fields) == 0 {
+			// a link without a url is just text
+			return &TextLine{Pos: pos, Text: line}
+		}
+
+		text := strings.TrimSpace(line[2:])
+		text = strings.TrimSpace(text[len(fields[0]):])
+		return &LinkLine{Pos: pos, URL: fields[0], Text: text}
+
+	case strings.HasPrefix(line, "#"):
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		if level > 3 {
+			level = 3
+		}
+		return &HeadingLine{Pos: pos, Level: level, Text: strings.TrimSpace(line[level:])}
+
+	case strings.HasPrefix(line, "* "):
+		return &ListItemLine{Pos: pos, Text: strings.TrimSpace(line[2:])}
+
+	case strings.HasPrefix(line, ">"):
+		return &QuoteLine{Pos: pos, Text: strings.TrimSpace(line[1:])}
+
+	default:
+		return &TextLine{Pos: pos, Text: line}
+	}
+}
+
+// parses a text/gemini document into its lines. blank lines are kept as empty TextLines
+// so the document can be rendered back as it was
+func ParseGemtext(r io.Reader) ([]GemtextLine, error) {
+	var lines []GemtextLine
+	var pre *PreformattedBlock
+
+	reader := bufio.NewReader(r)
+	for pos := 1; ; pos++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && line == "" {
+			break
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		switch {
+		case strings.HasPrefix(line, "```") && pre == nil:
+			pre = &PreformattedBlock{Pos: pos, Alt: strings.TrimSpace(line[3:])}
+		case strings.HasPrefix(line, "```"):
+			pre.EndPos = pos
+			lines = append(lines, pre)
+			pre = nil
+		case pre != nil:
+			pre.Lines = append(pre.Lines, line)
+		default:
+			lines = append(lines, parseGemtextLine(pos, line))
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	// an unclosed block runs to the end of the document
+	if pre != nil {
+		pre.EndPos = pre.Pos + len(pre.Lines)
+		lines = append(lines, pre)
+	}
+
+	return lines, nil
+}
@@ -1,23 +1,708 @@
 package gemini
 
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ========================================[[ Handler ]]========================================= */
+
+// anything that can respond to a peer's request. routers, file servers, CGI handlers,
+// etc. all implement it so they can be composed (eg. mounted in a pathHandler)
+type Handler interface {
+	ServeGemini(peer *GeminiPeer)
+}
+
+// adapts a plain function to a Handler
+type HandlerFunc func(peer *GeminiPeer)
+
+func (f HandlerFunc) ServeGemini(peer *GeminiPeer) {
+	f(peer)
+}
+
 /* ======================================[[ pathHandler ]]======================================= */
 
+// a route matching more than a single path. match reports whether path matches and
+// the parameters captured from it
+type patternRoute struct {
+	pattern  string
+	segments []string // of ':param' patterns, nil for regex ones
+	match    func(path string) (map[string]string, bool)
+	route    *Route
+}
+
+// wraps a handler, eg. to log requests or check for a client certificate before
+// (or instead of) calling next
+type Middleware func(next Handler) Handler
+
+// a route matching every path under prefix, see pathHandler.Handle()
+type prefixRoute struct {
+	prefix string
+	route  *Route
+}
+
+// describes a registered route, returned by pathHandler.Handle() & co. so a name, title
+// and description can be attached (eg. for logs & Stats(), or the sitemap, see
+// pathHandler.SetSitemap())
+type Route struct {
+	Path        string // as registered, eg. "/user/:id"
+	Name        string // eg. "blog_post", shown in logs
+	Title       string
+	Description string
+	HandlerName string // filled in by pathHandler.Routes()
+
+	link    string // what a link to the route points to, "" if it can't be linked to
+	handler Handler
+}
+
+// sets the route's name, returns the route so calls can be chained
+func (route *Route) WithName(name string) *Route {
+	route.Name = name
+	return route
+}
+
+// returns the route's name, or the path it was registered with if it has none
+func (route *Route) label() string {
+	if route.Name != "" {
+		return route.Name
+	}
+	return route.Path
+}
+
+// describes handler for humans, eg. "main.showPost" or "*gemini.fileHandler"
+func handlerName(handler Handler) string {
+	switch hndlr := handler.(type) {
+	case HandlerFunc:
+		if fn := runtime.FuncForPC(reflect.ValueOf(hndlr).Pointer()); fn != nil {
+			return fn.Name()
+		}
+	case *redirectRoute:
+		return "redirect to " + hndlr.to
+	case *groupRoute:
+		return handlerName(hndlr.handler)
+	}
+
+	return fmt.Sprintf("%T", handler)
+}
+
+// sets the route's title, returns the route so calls can be chained
+func (route *Route) WithTitle(title string) *Route {
+	route.Title = title
+	return route
+}
+
+// sets the route's description, returns the route so calls can be chained
+func (route *Route) WithDescription(description string) *Route {
+	route.Description = description
+	return route
+}
+
 type pathHandler struct {
-	pathTbl map[string]func(peer *GeminiPeer)
+	routes        []*Route // in the order they were registered
+	pathTbl       map[string]*Route
+	patterns      []*patternRoute
+	prefixes      []*prefixRoute // sorted longest first
+	middleware    []Middleware
+	notFound      Handler
+	trailingSlash TrailingSlashMode
+	ignoreCase    bool
+	statsMu       sync.Mutex
+	stats         map[string]*RouteStats
 }
 
 func NewHandler() *pathHandler {
-	return &pathHandler{pathTbl: map[string]func(peer *GeminiPeer){}}
+	return &pathHandler{
+		pathTbl:  map[string]*Route{},
+		notFound: HandlerFunc(sendPathNotFound),
+		stats:    map[string]*RouteStats{},
+	}
+}
+
+// longest path (or hostname) quoted back to the peer in an error's meta
+const maxQuotedSize = 128
+
+// default handler for requests no route matches
+func sendPathNotFound(peer *GeminiPeer) {
+	peer.SendNotFound("Path '" + shortenText(peer.path, maxQuotedSize) + "' not found!")
 }
 
-func (pHndlr *pathHandler) AddHandler(path string, handler func(peer *GeminiPeer)) {
-	pHndlr.pathTbl[path] = handler
+// sets the handler called when no route matches the request (eg. for a custom 404
+// page). it's wrapped by the router's middleware like any other route
+func (pHndlr *pathHandler) SetNotFoundHandler(handler Handler) {
+	pHndlr.notFound = handler
 }
 
-func (pHndlr *pathHandler) HandlePeer(peer *GeminiPeer) {
-	if hndlr, exists := pHndlr.pathTbl[peer.path]; exists {
-		hndlr(peer)
+// returns a copy of every registered route in the order they were registered, eg. to
+// build an admin page or check every expected route exists
+func (pHndlr *pathHandler) Routes() []Route {
+	routes := make([]Route, len(pHndlr.routes))
+	for i, route := range pHndlr.routes {
+		routes[i] = *route
+		routes[i].HandlerName = handlerName(route.handler)
+	}
+
+	return routes
+}
+
+// same as Handle(), for plain functions
+func (pHndlr *pathHandler) AddHandler(path string, handler func(peer *GeminiPeer)) *Route {
+	return pHndlr.Handle(path, HandlerFunc(handler))
+}
+
+// records a registered route. registering the same path again replaces its route
+func (pHndlr *pathHandler) addRoute(path, link string, handler Handler) *Route {
+	route := &Route{Path: path, link: link, handler: handler}
+	for i, old := range pHndlr.routes {
+		if old.Path == path {
+			pHndlr.routes[i] = route
+			return route
+		}
+	}
+
+	pHndlr.routes = append(pHndlr.routes, route)
+	return route
+}
+
+// registers handler for path. segments of path starting with ':' (eg. "/user/:id")
+// match any single segment of the request path, the matched value is available to the
+// handler through peer.PathParam("id"). a path ending in "/*" (eg. "/static/*") matches
+// every path under that prefix, the remainder is available through peer.PathParam("*").
+//
+// when several routes match a request, the most specific one wins:
+//   - exact paths (eg. "/about", or "/static/" for "/static/*")
+//   - ':param' and regex patterns, in the order they were added
+//   - the path with/without its trailing slash, see SetTrailingSlash()
+//   - prefixes, longest first (so "/*" acts as a catch-all)
+func (pHndlr *pathHandler) Handle(path string, handler Handler) *Route {
+	if strings.HasSuffix(path, "/*") {
+		prefix := strings.TrimSuffix(path, "*")
+		route := pHndlr.addRoute(path, prefix, handler)
+		pHndlr.addPrefix(prefix, route)
+		return route
+	}
+
+	if !strings.Contains(path, "/:") {
+		route := pHndlr.addRoute(path, path, handler)
+		pHndlr.pathTbl[path] = route
+		return route
+	}
+
+	route := pHndlr.addRoute(path, "", handler)
+	segments := strings.Split(path, "/")
+	pHndlr.addPattern(&patternRoute{
+		pattern:  path,
+		segments: segments,
+		match: func(reqPath string) (map[string]string, bool) {
+			return matchSegments(segments, reqPath)
+		},
+		route: route,
+	})
+	return route
+}
+
+// same as HandleRegex(), for plain functions
+func (pHndlr *pathHandler) AddRegexHandler(re *regexp.Regexp, handler func(peer *GeminiPeer)) *Route {
+	return pHndlr.HandleRegex(re, HandlerFunc(handler))
+}
+
+// registers handler for request paths fully matched by re. capture groups are available
+// to the handler through peer.PathParam(), by name for named groups (eg. "(?P<year>\d+)")
+// and by index for every group (eg. "1"). regex routes are tried alongside ':param'
+// patterns, in the order they were added
+func (pHndlr *pathHandler) HandleRegex(re *regexp.Regexp, handler Handler) *Route {
+	// anchor the expression so the leftmost match can't stop short of the end of the path
+	anchored := regexp.MustCompile(`^(?:` + re.String() + `)$`)
+	route := pHndlr.addRoute(re.String(), "", handler)
+	pHndlr.addPattern(&patternRoute{
+		pattern: re.String(),
+		match: func(reqPath string) (map[string]string, bool) {
+			return matchRegex(anchored, reqPath)
+		},
+		route: route,
+	})
+	return route
+}
+
+// records a ':param' or regex route. registering the same pattern again replaces its
+// route, keeping its place in the order patterns are tried
+func (pHndlr *pathHandler) addPattern(pattern *patternRoute) {
+	for i, old := range pHndlr.patterns {
+		if old.pattern == pattern.pattern {
+			pHndlr.patterns[i] = pattern
+			return
+		}
+	}
+
+	pHndlr.patterns = append(pHndlr.patterns, pattern)
+}
+
+// a route answering every request with a redirect, see pathHandler.AddRedirect()
+type redirectRoute struct {
+	to        string
+	permanent bool
+}
+
+// builds the redirect target for the peer: ':name' segments of route.to are replaced by the
+// matching path parameters, a trailing "*" by the remainder matched by a prefix route. the
+// request's query is carried over unless route.to has its own
+func (route *redirectRoute) target(peer *GeminiPeer) string {
+	segments := strings.Split(route.to, "/")
+	for i, segment := range segments {
+		switch {
+		case len(segment) > 1 && segment[0] == ':':
+			segments[i] = url.PathEscape(peer.PathParam(segment[1:]))
+		case segment == "*" && i == len(segments)-1:
+			rest := strings.Split(peer.PathParam("*"), "/")
+			for j := range rest {
+				rest[j] = url.PathEscape(rest[j])
+			}
+			segments[i] = strings.Join(rest, "/")
+		}
+	}
+
+	target := strings.Join(segments, "/")
+	if query := peer.rawQuery(); query != "" && !strings.Contains(route.to, "?") {
+		target += "?" + query
+	}
+	return target
+}
+
+func (route *redirectRoute) ServeGemini(peer *GeminiPeer) {
+	if route.permanent {
+		peer.SendPermanentRedirect(route.target(peer))
+	} else {
+		peer.SendRedirect(route.target(peer))
+	}
+}
+
+// registers a route redirecting requests for from to to, with StatusRedirectPerm if
+// permanent is set (StatusRedirectTemp otherwise). from is matched like any other route,
+// and its parameters can be used in to, eg.
+//
+//	AddRedirect("/old.gmi", "/new.gmi", true)
+//	AddRedirect("/user/:id", "/users/:id", true)
+//	AddRedirect("/blog/*", "gemini://blog.example.org/*", true) // "/blog" is moved too
+//
+// the request's query is kept unless to has its own. when the router isn't in
+// TrailingSlashStrict mode, "/old.gmi/" is redirected straight to to rather than through
+// the canonical "/old.gmi" first
+func (pHndlr *pathHandler) AddRedirect(from, to string, permanent bool) {
+	pHndlr.Handle(from, &redirectRoute{to: to, permanent: permanent})
+
+	// a moved directory takes its bare name with it
+	if base := strings.TrimSuffix(from, "/*"); base != from && base != "" {
+		pHndlr.Handle(base, &redirectRoute{to: strings.TrimSuffix(to, "/*"), permanent: permanent})
+	}
+}
+
+// registers a prefix route, keeping prefixes sorted longest first. registering the
+// same prefix again replaces its handler
+func (pHndlr *pathHandler) addPrefix(prefix string, route *Route) {
+	for _, old := range pHndlr.prefixes {
+		if old.prefix == prefix {
+			old.route = route
+			return
+		}
+	}
+
+	pHndlr.prefixes = append(pHndlr.prefixes, &prefixRoute{prefix: prefix, route: route})
+	sort.SliceStable(pHndlr.prefixes, func(i, j int) bool {
+		return len(pHndlr.prefixes[i].prefix) > len(pHndlr.prefixes[j].prefix)
+	})
+}
+
+// matches reqPath against an anchored re
+func matchRegex(re *regexp.Regexp, reqPath string) (map[string]string, bool) {
+	loc := re.FindStringSubmatchIndex(reqPath)
+	if loc == nil {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, name := range re.SubexpNames() {
+		// skip the whole match & groups that didn't participate
+		if i == 0 || loc[2*i] < 0 {
+			continue
+		}
+
+		value := reqPath[loc[2*i]:loc[2*i+1]]
+		params[strconv.Itoa(i)] = value
+		if name != "" {
+			params[name] = value
+		}
+	}
+
+	return params, true
+}
+
+// matches reqPath against the segments of a pattern, collecting ':name' parameters
+func matchSegments(segments []string, reqPath string) (map[string]string, bool) {
+	reqSegments := strings.Split(reqPath, "/")
+	if len(reqSegments) != len(segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			// parameters can't match empty segments
+			if reqSegments[i] == "" {
+				return nil, false
+			}
+
+			params[segment[1:]] = reqSegments[i]
+		} else if segment != reqSegments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// finds the handler for the peer's request path, returns nil if there is none
+func (pHndlr *pathHandler) lookup(peer *GeminiPeer) Handler {
+	peer.route = nil
+	if hndlr := pHndlr.match(peer, peer.path); hndlr != nil {
+		return hndlr
+	}
+
+	// the path with/without its trailing slash beats a prefix route
+	if hndlr := pHndlr.matchAlt(peer); hndlr != nil {
+		return hndlr
+	}
+
+	if pHndlr.ignoreCase {
+		return pHndlr.matchFold(peer)
+	}
+
+	return pHndlr.matchPrefix(peer, peer.path)
+}
+
+// tries the path with/without its trailing slash, returns nil if there is no such route
+func (pHndlr *pathHandler) matchAlt(peer *GeminiPeer) Handler {
+	if pHndlr.trailingSlash == TrailingSlashStrict || peer.path == "/" || peer.path == "" {
+		return nil
+	}
+
+	var alt, redirect string
+	if strings.HasSuffix(peer.path, "/") {
+		alt = strings.TrimSuffix(peer.path, "/")
+		redirect = "../" + path.Base(alt)
 	} else {
-		peer.SendError("Path '" + peer.path + "' not found!")
+		alt = peer.path + "/"
+		redirect = path.Base(peer.path) + "/"
+	}
+
+	hndlr := pHndlr.match(peer, alt)
+	if _, isRedirect := hndlr.(*redirectRoute); isRedirect || hndlr == nil || pHndlr.trailingSlash == TrailingSlashRewrite {
+		return hndlr
+	}
+
+	// redirects are relative so they still work when mounted under a prefix
+	if query := peer.rawQuery(); query != "" {
+		redirect += "?" + query
+	}
+	return HandlerFunc(func(peer *GeminiPeer) {
+		peer.SendPermanentRedirect(redirect)
+	})
+}
+
+// finds an exact or pattern route matching reqPath, returns nil if there is none
+func (pHndlr *pathHandler) match(peer *GeminiPeer, reqPath string) Handler {
+	if route, exists := pHndlr.pathTbl[reqPath]; exists {
+		// don't leak what a parent router captured
+		peer.pathParams = nil
+		peer.route = route
+		return route.handler
+	}
+
+	for _, pattern := range pHndlr.patterns {
+		if params, ok := pattern.match(reqPath); ok {
+			peer.pathParams = params
+			peer.route = pattern.route
+			return pattern.route.handler
+		}
+	}
+
+	// a prefix route matching the whole path (eg. "/static/*" for "/static/") is as good
+	// as an exact one
+	for _, prefix := range pHndlr.prefixes {
+		if prefix.prefix == reqPath {
+			peer.pathParams = map[string]string{"*": ""}
+			peer.route = prefix.route
+			return prefix.route.handler
+		}
 	}
+
+	return nil
+}
+
+// finds the longest prefix route matching reqPath, returns nil if there is none
+func (pHndlr *pathHandler) matchPrefix(peer *GeminiPeer, reqPath string) Handler {
+	for _, prefix := range pHndlr.prefixes {
+		if strings.HasPrefix(reqPath, prefix.prefix) {
+			peer.pathParams = map[string]string{"*": reqPath[len(prefix.prefix):]}
+			peer.route = prefix.route
+			return prefix.route.handler
+		}
+	}
+
+	return nil
+}
+
+// finds the route matching the peer's path regardless of case. if the path's case differs
+// from the route's, the peer is redirected to the canonical path instead. returns nil if
+// there is no such route
+func (pHndlr *pathHandler) matchFold(peer *GeminiPeer) Handler {
+	canonical, hndlr := pHndlr.canonicalPath(peer, peer.path)
+	if hndlr == nil || canonical == peer.path {
+		return hndlr
+	}
+
+	redirect := relativeLink(peer.path, canonical)
+	if query := peer.rawQuery(); query != "" {
+		redirect += "?" + query
+	}
+	return HandlerFunc(func(peer *GeminiPeer) {
+		peer.SendPermanentRedirect(redirect)
+	})
+}
+
+// returns the path a route was registered with (with any parameters or prefix remainder
+// filled in from reqPath) if it matches reqPath regardless of case, along with its handler
+func (pHndlr *pathHandler) canonicalPath(peer *GeminiPeer, reqPath string) (string, Handler) {
+	for registered, route := range pHndlr.pathTbl {
+		if strings.EqualFold(registered, reqPath) {
+			peer.pathParams = nil
+			peer.route = route
+			return registered, route.handler
+		}
+	}
+
+	reqSegments := strings.Split(reqPath, "/")
+patterns:
+	for _, pattern := range pHndlr.patterns {
+		if len(pattern.segments) != len(reqSegments) {
+			continue
+		}
+
+		canonical := make([]string, len(reqSegments))
+		params := map[string]string{}
+		for i, segment := range pattern.segments {
+			switch {
+			case strings.HasPrefix(segment, ":") && reqSegments[i] != "":
+				canonical[i] = reqSegments[i]
+				params[segment[1:]] = reqSegments[i]
+			case strings.EqualFold(segment, reqSegments[i]):
+				canonical[i] = segment
+			default:
+				continue patterns
+			}
+		}
+
+		peer.pathParams = params
+		peer.route = pattern.route
+		return strings.Join(canonical, "/"), pattern.route.handler
+	}
+
+	for _, prefix := range pHndlr.prefixes {
+		if len(reqPath) >= len(prefix.prefix) && strings.EqualFold(reqPath[:len(prefix.prefix)], prefix.prefix) {
+			rest := reqPath[len(prefix.prefix):]
+			peer.pathParams = map[string]string{"*": rest}
+			peer.route = prefix.route
+			return prefix.prefix + rest, prefix.route.handler
+		}
+	}
+
+	return "", nil
+}
+
+// if enabled, paths match routes regardless of case (eg. "/About.gmi" matches
+// "/about.gmi"), and peers are redirected to the path the route was registered with.
+// ':param' values and what follows a prefix keep their case, regex routes are left alone
+// (use "(?i)" for those). disabled by default
+func (pHndlr *pathHandler) SetCaseInsensitive(enabled bool) {
+	pHndlr.ignoreCase = enabled
+}
+
+// controls how the router treats requests for "/foo/" when only "/foo" is registered
+// (and vice versa)
+type TrailingSlashMode int
+
+const (
+	// only the registered form matches (the default)
+	TrailingSlashStrict TrailingSlashMode = iota
+	// the other form is handled by the same route
+	TrailingSlashRewrite
+	// the other form is answered with a StatusRedirectPerm to the registered form
+	TrailingSlashRedirect
+)
+
+// sets how requests differing from a route only by a trailing slash are treated
+func (pHndlr *pathHandler) SetTrailingSlash(mode TrailingSlashMode) {
+	pHndlr.trailingSlash = mode
+}
+
+// adds middleware wrapping every request handled by the router (including requests
+// that don't match any route). middleware runs in the order it was added, so the
+// first one added sees the request first
+func (pHndlr *pathHandler) Use(mw ...Middleware) {
+	pHndlr.middleware = append(pHndlr.middleware, mw...)
+}
+
+// wraps handler with mw, mw[0] being the outermost
+func chain(handler Handler, mw []Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i](handler)
+	}
+
+	return handler
+}
+
+func (pHndlr *pathHandler) ServeGemini(peer *GeminiPeer) {
+	hndlr := pHndlr.lookup(peer)
+	if hndlr == nil {
+		hndlr = pHndlr.notFound
+	}
+
+	// grab the route now, a mounted router will replace it with its own
+	route := peer.route
+	defer pHndlr.record(route, peer, time.Now())
+
+	chain(hndlr, pHndlr.middleware).ServeGemini(peer)
+}
+
+// same as ServeGemini(), can be passed to GeminiServer.Run()
+func (pHndlr *pathHandler) HandlePeer(peer *GeminiPeer) {
+	pHndlr.ServeGemini(peer)
+}
+
+/* =======================================[[ routeGroup ]]======================================== */
+
+// a set of routes sharing a path prefix and middleware, see pathHandler.Group()
+type routeGroup struct {
+	router     *pathHandler
+	parent     *routeGroup
+	prefix     string
+	middleware []Middleware
+}
+
+// returns a group whose routes are registered on pHndlr with prefix prepended (eg.
+// "/blog" + "/:post"). middleware added to the group only wraps the group's routes,
+// and runs after the router's own middleware
+func (pHndlr *pathHandler) Group(prefix string) *routeGroup {
+	return &routeGroup{router: pHndlr, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// returns a nested group, inheriting this group's prefix and middleware
+func (group *routeGroup) Group(prefix string) *routeGroup {
+	return &routeGroup{router: group.router, parent: group, prefix: group.prefix + strings.TrimSuffix(prefix, "/")}
+}
+
+// adds middleware wrapping the group's routes (and those of nested groups)
+func (group *routeGroup) Use(mw ...Middleware) {
+	group.middleware = append(group.middleware, mw...)
+}
+
+// wraps handler so the middleware of the group and its parents is applied at request
+// time, so middleware added after a route was registered still applies to it
+func (group *routeGroup) wrap(handler Handler) Handler {
+	return &groupRoute{group: group, handler: handler}
+}
+
+// a handler registered through a routeGroup
+type groupRoute struct {
+	group   *routeGroup
+	handler Handler
+}
+
+func (route *groupRoute) ServeGemini(peer *GeminiPeer) {
+	var mw []Middleware
+	for g := route.group; g != nil; g = g.parent {
+		mw = append(append([]Middleware{}, g.middleware...), mw...)
+	}
+
+	chain(route.handler, mw).ServeGemini(peer)
+}
+
+// same as pathHandler.AddHandler(), with the group's prefix prepended to path
+func (group *routeGroup) AddHandler(path string, handler func(peer *GeminiPeer)) *Route {
+	return group.Handle(path, HandlerFunc(handler))
+}
+
+// same as pathHandler.Handle(), with the group's prefix prepended to path
+func (group *routeGroup) Handle(path string, handler Handler) *Route {
+	return group.router.Handle(group.prefix+path, group.wrap(handler))
+}
+
+// same as pathHandler.AddRegexHandler(), re has to match what follows the group's prefix
+func (group *routeGroup) AddRegexHandler(re *regexp.Regexp, handler func(peer *GeminiPeer)) *Route {
+	return group.HandleRegex(re, HandlerFunc(handler))
+}
+
+// same as pathHandler.HandleRegex(), re has to match what follows the group's prefix
+func (group *routeGroup) HandleRegex(re *regexp.Regexp, handler Handler) *Route {
+	prefixed := regexp.MustCompile(regexp.QuoteMeta(group.prefix) + `(?:` + re.String() + `)`)
+	return group.router.HandleRegex(prefixed, group.wrap(handler))
+}
+
+// mounts handler (eg. another pathHandler packaging a gemlog or guestbook) at prefix, so
+// it sees request paths with prefix removed: a child route for "/post/:id" mounted at
+// "/blog" answers "/blog/post/1". requests for the bare prefix ("/blog") are redirected
+// to "/blog/" so relative links in the child's pages resolve under the prefix
+func (pHndlr *pathHandler) Mount(prefix string, handler Handler) *Route {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" {
+		pHndlr.Handle(prefix, &redirectRoute{to: path.Base(prefix) + "/", permanent: true})
+	}
+
+	return pHndlr.Handle(prefix+"/*", StripPrefix(prefix, handler))
+}
+
+/* =======================================[[ StripPrefix ]]======================================= */
+
+// wraps handler so it sees the request path with prefix removed (eg. "/files/a.gmi" ->
+// "/a.gmi"), so file servers and sub-apps can be mounted anywhere. requests for the bare
+// prefix are redirected to "prefix/", requests whose path doesn't start with prefix are
+// answered with StatusNotFound
+func StripPrefix(prefix string, handler Handler) Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return HandlerFunc(func(peer *GeminiPeer) {
+		if !strings.HasPrefix(peer.path, prefix) {
+			sendPathNotFound(peer)
+			return
+		}
+
+		stripped := peer.path[len(prefix):]
+		if stripped == "" && prefix != "" {
+			// relative links only resolve inside prefix with a trailing slash, same as Mount()
+			redirect := path.Base(prefix) + "/"
+			if query := peer.rawQuery(); query != "" {
+				redirect += "?" + query
+			}
+			peer.SendPermanentRedirect(redirect)
+			return
+		} else if stripped == "" {
+			stripped = "/"
+		} else if stripped[0] != '/' {
+			// eg. "/filesystem" doesn't belong to "/files"
+			sendPathNotFound(peer)
+			return
+		}
+
+		original := peer.path
+		peer.path = stripped
+		defer func() { peer.path = original }()
+
+		handler.ServeGemini(peer)
+	})
 }
@@ -0,0 +1,240 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// answers every request with "10 <name>", so tests can tell which route matched
+func named(name string) func(peer *GeminiPeer) {
+	return func(peer *GeminiPeer) {
+		peer.SendInput(name)
+	}
+}
+
+// routes a request for reqPath through router, returning the whole response it got
+func serveResponse(router Handler, reqPath string) string {
+	client, conn := net.Pipe()
+	peer := &GeminiPeer{sock: conn, out: bufio.NewWriter(conn), rawURL: "gemini://localhost" + reqPath, path: reqPath}
+	peer.ctx, peer.cancel = context.WithCancel(context.Background())
+
+	response := make(chan string)
+	go func() {
+		raw, _ := io.ReadAll(client)
+		response <- string(raw)
+	}()
+
+	router.ServeGemini(peer)
+	peer.Close()
+	return <-response
+}
+
+// same as serveResponse(), but only returns the response header (without the <CR><LF>)
+func serve(router Handler, reqPath string) string {
+	header, _, _ := strings.Cut(serveResponse(router, reqPath), "\r\n")
+	return header
+}
+
+// same as serveResponse(), but only returns the response body
+func serveBody(router Handler, reqPath string) string {
+	_, body, _ := strings.Cut(serveResponse(router, reqPath), "\r\n")
+	return body
+}
+
+type routeTest struct {
+	path string
+	want string
+}
+
+func checkRoutes(t *testing.T, router Handler, tests []routeTest) {
+	t.Helper()
+	for _, test := range tests {
+		if got := serve(router, test.path); got != test.want {
+			t.Errorf("%s: got '%s', want '%s'", test.path, got, test.want)
+		}
+	}
+}
+
+func TestExactBeatsPrefix(t *testing.T) {
+	router := NewHandler()
+	router.AddHandler("/static/*", named("prefix"))
+	router.AddHandler("/static/logo.png", named("exact"))
+
+	checkRoutes(t, router, []routeTest{
+		{"/static/logo.png", "10 exact"},
+		{"/static/logo.png2", "10 prefix"},
+		{"/static/img/logo.png", "10 prefix"},
+		{"/static/", "10 prefix"},
+		{"/other", "51 Path '/other' not found!"},
+	})
+}
+
+func TestLongestPrefixBeatsWildcard(t *testing.T) {
+	router := NewHandler()
+	router.AddHandler("/*", named("catch-all"))
+	router.AddHandler("/docs/*", named("docs"))
+	router.AddHandler("/docs/api/*", named("api"))
+
+	checkRoutes(t, router, []routeTest{
+		{"/", "10 catch-all"},
+		{"/about", "10 catch-all"},
+		{"/docs/intro", "10 docs"},
+		{"/docs/api/v1/users", "10 api"},
+		{"/docs/apix", "10 docs"},
+	})
+}
+
+func TestPatternsBeatPrefixes(t *testing.T) {
+	router := NewHandler()
+	router.AddHandler("/files/*", named("prefix"))
+	router.AddHandler("/files/:name", named("param"))
+	router.AddHandler("/files/readme", named("exact"))
+
+	checkRoutes(t, router, []routeTest{
+		{"/files/readme", "10 exact"},
+		{"/files/notes", "10 param"},
+		{"/files/notes/old", "10 prefix"},
+	})
+}
+
+func TestParamsAndRegexesInOrder(t *testing.T) {
+	router := NewHandler()
+	router.AddHandler("/user/:id", named("param"))
+	router.AddRegexHandler(regexp.MustCompile(`/user/(\d+)`), named("regex"))
+	router.AddRegexHandler(regexp.MustCompile(`/post/(\d+)`), named("post regex"))
+	router.AddHandler("/post/:id", named("post param"))
+	router.AddHandler("/user/me", named("exact"))
+
+	checkRoutes(t, router, []routeTest{
+		{"/user/me", "10 exact"},
+		{"/user/42", "10 param"},      // added first
+		{"/post/42", "10 post regex"}, // added first
+		{"/post/latest", "10 post param"},
+		{"/post/42/comments", "51 Path '/post/42/comments' not found!"}, // regexes match the whole path
+	})
+}
+
+func TestReregisteringReplaces(t *testing.T) {
+	router := NewHandler()
+	router.AddHandler("/user/:id", named("first"))
+	router.AddRegexHandler(regexp.MustCompile(`/post/(\d+)`), named("first regex"))
+	router.AddHandler("/user/:id", named("second"))
+	router.AddRegexHandler(regexp.MustCompile(`/post/(\d+)`), named("second regex"))
+
+	checkRoutes(t, router, []routeTest{
+		{"/user/42", "10 second"},
+		{"/post/42", "10 second regex"},
+	})
+
+	if routes := router.Routes(); len(routes) != 2 {
+		t.Errorf("got %d routes, want 2", len(routes))
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	newRouter := func(mode TrailingSlashMode) *pathHandler {
+		router := NewHandler()
+		router.AddHandler("/about", named("about"))
+		router.AddHandler("/log/", named("log"))
+		router.SetTrailingSlash(mode)
+		return router
+	}
+
+	checkRoutes(t, newRouter(TrailingSlashStrict), []routeTest{
+		{"/about", "10 about"},
+		{"/about/", "51 Path '/about/' not found!"},
+		{"/log", "51 Path '/log' not found!"},
+	})
+
+	checkRoutes(t, newRouter(TrailingSlashRewrite), []routeTest{
+		{"/about/", "10 about"},
+		{"/log", "10 log"},
+	})
+
+	checkRoutes(t, newRouter(TrailingSlashRedirect), []routeTest{
+		{"/about/", "31 ../about"},
+		{"/log", "31 log/"},
+		{"/about", "10 about"},
+	})
+
+	// the other form of a registered path beats a prefix route
+	router := newRouter(TrailingSlashRewrite)
+	router.AddHandler("/*", named("catch-all"))
+	checkRoutes(t, router, []routeTest{
+		{"/about/", "10 about"},
+		{"/about/more", "10 catch-all"},
+	})
+}
+
+func TestNotFoundMeta(t *testing.T) {
+	router := NewHandler()
+	long := "/" + strings.Repeat("a", 2000)
+
+	checkRoutes(t, router, []routeTest{
+		{"/a\r\n20 text/gemini", "51 Path '/a  20 text/gemini' not found!"},
+		{"/\x00", "51 Path '/ ' not found!"},
+		{long, "51 Path '" + long[:maxQuotedSize-3] + "...' not found!"},
+	})
+
+	response := serveResponse(router, "/a\r\n20 text/gemini")
+	if strings.Count(response, "\r\n") != 1 {
+		t.Errorf("header was split: %q", response)
+	}
+
+	if meta := cleanMeta(strings.Repeat("é", 1000)); len(meta) > maxMetaSize || !utf8.ValidString(meta) {
+		t.Errorf("cleanMeta() returned %d bytes, valid utf-8: %v", len(meta), utf8.ValidString(meta))
+	}
+}
+
+func TestPathParamsDontLeak(t *testing.T) {
+	echo := func(peer *GeminiPeer) {
+		peer.SendInput("[" + peer.PathParam("*") + "][" + peer.PathParam("id") + "]")
+	}
+
+	child := NewHandler()
+	child.AddHandler("/intro", echo)
+	child.AddHandler("/:id", echo)
+
+	router := NewHandler()
+	router.Handle("/docs/*", StripPrefix("/docs", child))
+
+	checkRoutes(t, router, []routeTest{
+		{"/docs/intro", "10 [][]"},
+		{"/docs/42", "10 [][42]"},
+	})
+
+	child.SetCaseInsensitive(true)
+	checkRoutes(t, router, []routeTest{
+		{"/docs/intro", "10 [][]"},
+	})
+}
+
+func TestStripPrefix(t *testing.T) {
+	child := NewHandler()
+	child.AddHandler("/", named("index"))
+	child.AddHandler("/intro", named("intro"))
+
+	router := NewHandler()
+	router.Handle("/docs/*", StripPrefix("/docs", child))
+	router.Handle("/docs", StripPrefix("/docs/", child))
+
+	checkRoutes(t, router, []routeTest{
+		{"/docs", "31 docs/"},
+		{"/docs/", "10 index"},
+		{"/docs/intro", "10 intro"},
+		{"/docsx", "51 Path '/docsx' not found!"},
+	})
+}
@@ -0,0 +1,96 @@
+package gemini
+
+import (
+	"net"
+	"strings"
+)
+
+/* ======================================[[ hostHandler ]]======================================= */
+
+type hostHandler struct {
+	hostTbl   map[string]Handler
+	wildcards map[string]Handler
+	fallback  Handler
+}
+
+// dispatches requests to a handler per requested hostname, eg. so one server can serve
+// both example.org and gem.example.net. pair with GeminiServer.AddCertificate() to
+// present the right certificate for each host
+func NewHostHandler() *hostHandler {
+	return &hostHandler{
+		hostTbl:   map[string]Handler{},
+		wildcards: map[string]Handler{},
+	}
+}
+
+// lowercases hostname and strips any port or trailing dot. internationalized hostnames
+// are converted to punycode, so they match however the peer wrote them
+func normalizeHost(hostname string) string {
+	if host, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = host
+	}
+
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if asciiHost, err := ToASCII(hostname); err == nil {
+		hostname = asciiHost
+	}
+	return hostname
+}
+
+// same as Handle(), for plain functions
+func (hHndlr *hostHandler) AddHost(hostname string, handler func(peer *GeminiPeer)) {
+	hHndlr.Handle(hostname, HandlerFunc(handler))
+}
+
+// registers handler for requests to hostname. a leading "*." (eg. "*.example.org")
+// matches any subdomain, exact hostnames take priority over wildcards
+func (hHndlr *hostHandler) Handle(hostname string, handler Handler) {
+	hostname = normalizeHost(hostname)
+	if strings.HasPrefix(hostname, "*.") {
+		hHndlr.wildcards[hostname[1:]] = handler
+	} else {
+		hHndlr.hostTbl[hostname] = handler
+	}
+}
+
+// sets the handler for requests to hostnames that weren't registered. by default
+// they're refused with StatusProxyRefused
+func (hHndlr *hostHandler) SetDefault(handler Handler) {
+	hHndlr.fallback = handler
+}
+
+// finds the handler for hostname, returns nil if there is none
+func (hHndlr *hostHandler) lookup(hostname string) Handler {
+	hostname = normalizeHost(hostname)
+	if hndlr, exists := hHndlr.hostTbl[hostname]; exists {
+		return hndlr
+	}
+
+	// try the most specific wildcard first, eg. "*.a.example.org" before "*.example.org"
+	for i := strings.Index(hostname, "."); i != -1; {
+		if hndlr, exists := hHndlr.wildcards[hostname[i:]]; exists {
+			return hndlr
+		}
+
+		next := strings.Index(hostname[i+1:], ".")
+		if next == -1 {
+			break
+		}
+		i += next + 1
+	}
+
+	return hHndlr.fallback
+}
+
+func (hHndlr *hostHandler) ServeGemini(peer *GeminiPeer) {
+	if hndlr := hHndlr.lookup(peer.hostname); hndlr != nil {
+		hndlr.ServeGemini(peer)
+	} else {
+		peer.sendHeader(StatusProxyRefused, "Host '"+shortenText(peer.hostname, maxQuotedSize)+"' is not served here!")
+	}
+}
+
+// same as ServeGemini(), can be passed to GeminiServer.Run()
+func (hHndlr *hostHandler) HandlePeer(peer *GeminiPeer) {
+	hHndlr.ServeGemini(peer)
+}
@@ -0,0 +1,80 @@
+package gemini
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"time"
+)
+
+/* ====================================[[ Client Identities ]]==================================== */
+
+// a client certificate & its key, see GenerateClientCert()
+type Identity struct {
+	// ready to use as Client.Certificate, or in Client.Identities
+	Certificate tls.Certificate
+
+	// the same certificate & key PEM encoded, eg. to store the identity
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// generates a self-signed client certificate to use as a gemini identity, valid for
+// lifetime from now. commonName is what servers see as the identity's name. the key is
+// ECDSA P-256, which every TLS stack supports
+func GenerateClientCert(commonName string, lifetime time.Duration) (*Identity, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour), // tolerate clocks running a little behind
+		NotAfter:     now.Add(lifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{
+		Certificate: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf},
+		CertPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:      pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// writes the identity's certificate & key to PEM files, the key readable by its owner
+// only. they can be loaded back with tls.LoadX509KeyPair()
+func (identity *Identity) Save(certFile, keyFile string) error {
+	if err := os.WriteFile(keyFile, identity.KeyPEM, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, identity.CertPEM, 0644)
+}
@@ -0,0 +1,218 @@
+package gemini
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+/* ===============================[[ Internationalized Hostnames ]]=============================== */
+
+// punycode parameters, see RFC 3492 section 5
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+	punyPrefix      = "xn--"
+)
+
+var errPunycode = errors.New("gemini: malformed punycode")
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// encodes a label (without the "xn--" prefix)
+func punyEncode(label string) string {
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < 0x80 {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+	for handled < len(runes) {
+		// the smallest code point not handled yet
+		m := int(utf8.MaxRune) + 1
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+
+		delta += (m - n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+
+	return string(out)
+}
+
+// decodes a label (without the "xn--" prefix)
+func punyDecode(encoded string) (string, error) {
+	var out []rune
+	if i := strings.LastIndexByte(encoded, '-'); i != -1 {
+		for _, c := range encoded[:i] {
+			if c >= 0x80 {
+				return "", errPunycode
+			}
+			out = append(out, c)
+		}
+		encoded = encoded[i+1:]
+	}
+
+	n, i, bias := punyInitialN, 0, punyInitialBias
+	for pos := 0; pos < len(encoded); {
+		oldI, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(encoded) {
+				return "", errPunycode
+			}
+
+			var digit int
+			switch c := encoded[pos]; {
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c - 'A')
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", errPunycode
+			}
+			pos++
+
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punyBase - t
+			if w > utf8.MaxRune {
+				return "", errPunycode
+			}
+		}
+
+		bias = punyAdapt(i-oldI, len(out)+1, oldI == 0)
+		n += i / (len(out) + 1)
+		i %= len(out) + 1
+		if n > utf8.MaxRune {
+			return "", errPunycode
+		}
+
+		out = append(out, 0)
+		copy(out[i+1:], out[i:])
+		out[i] = rune(n)
+		i++
+	}
+
+	return string(out), nil
+}
+
+// converts an internationalized hostname (eg. "bücher.example") to the ascii form used
+// on the wire, for dialing, SNI & request urls (eg. "xn--bcher-kva.example"). labels are
+// lowercased, ascii hostnames are returned lowercased but otherwise untouched
+func ToASCII(hostname string) (string, error) {
+	labels := strings.Split(strings.ToLower(hostname), ".")
+	for i, label := range labels {
+		if !isASCII(label) {
+			if !utf8.ValidString(label) {
+				return "", errors.New("gemini: hostname isn't valid UTF-8")
+			}
+			labels[i] = punyPrefix + punyEncode(label)
+		}
+		if len(labels[i]) > 63 {
+			return "", errors.New("gemini: hostname label is too long")
+		}
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+// converts the punycode labels of hostname (eg. "xn--bcher-kva.example") back to
+// unicode for display (eg. "bücher.example"). labels that fail to decode are kept as-is
+func ToUnicode(hostname string) string {
+	labels := strings.Split(hostname, ".")
+	for i, label := range labels {
+		if len(label) > len(punyPrefix) && strings.EqualFold(label[:len(punyPrefix)], punyPrefix) {
+			if decoded, err := punyDecode(label[len(punyPrefix):]); err == nil {
+				labels[i] = decoded
+			}
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+func isASCII(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if str[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package gemini
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+/* ======================================[[ InputHandler ]]======================================= */
+
+// checks the user's input, the error's message is shown to the user when they're asked
+// again
+type InputValidator func(input string) error
+
+// rejects input longer than n characters
+func MaxLength(n int) InputValidator {
+	return func(input string) error {
+		if utf8.RuneCountInString(input) > n {
+			return fmt.Errorf("at most %d characters", n)
+		}
+		return nil
+	}
+}
+
+// rejects input not fully matched by re, message is shown to the user (eg. "a number")
+func MatchInput(re *regexp.Regexp, message string) InputValidator {
+	anchored := regexp.MustCompile(`^(?:` + re.String() + `)$`)
+	return func(input string) error {
+		if !anchored.MatchString(input) {
+			return fmt.Errorf("%s", message)
+		}
+		return nil
+	}
+}
+
+type inputHandler struct {
+	prompt     string
+	sensitive  bool
+	validators []InputValidator
+	handler    func(peer *GeminiPeer, input string)
+}
+
+// returns a handler asking the user for input with prompt, then calling handler with
+// what they entered. input failing a validator (see Validate()) is answered by asking
+// again, with the validator's error appended to the prompt. eg:
+//
+//	router.Handle("/search", gemini.InputHandler("Search for?", search).Validate(gemini.MaxLength(64)))
+func InputHandler(prompt string, handler func(peer *GeminiPeer, input string)) *inputHandler {
+	return &inputHandler{prompt: prompt, handler: handler}
+}
+
+// adds validators, run in the order they were added
+func (iHndlr *inputHandler) Validate(validators ...InputValidator) *inputHandler {
+	iHndlr.validators = append(iHndlr.validators, validators...)
+	return iHndlr
+}
+
+// if enabled, the user is asked with StatusSensitiveInput so clients don't echo what
+// they type (eg. for passwords)
+func (iHndlr *inputHandler) SetSensitive(sensitive bool) *inputHandler {
+	iHndlr.sensitive = sensitive
+	return iHndlr
+}
+
+func (iHndlr *inputHandler) ask(peer *GeminiPeer, prompt string) {
+	if iHndlr.sensitive {
+		peer.SendSensitiveInput(prompt)
+	} else {
+		peer.SendInput(prompt)
+	}
+}
+
+func (iHndlr *inputHandler) ServeGemini(peer *GeminiPeer) {
+	input, isParam := peer.GetParam()
+	if !isParam {
+		iHndlr.ask(peer, iHndlr.prompt)
+		return
+	}
+
+	for _, validate := range iHndlr.validators {
+		if err := validate(input); err != nil {
+			iHndlr.ask(peer, iHndlr.prompt+" ("+err.Error()+")")
+			return
+		}
+	}
+
+	iHndlr.handler(peer, input)
+}
+
+// same as ServeGemini(), can be passed to GeminiServer.Run()
+func (iHndlr *inputHandler) HandlePeer(peer *GeminiPeer) {
+	iHndlr.ServeGemini(peer)
+}
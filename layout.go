@@ -0,0 +1,71 @@
+package gemini
+
+import (
+	"time"
+)
+
+/* =======================================[[ Page Layout ]]======================================= */
+
+type LayoutLink struct {
+	URL  string
+	Text string
+}
+
+// wraps pages in a shared header (the capsule's title and nav links) and footer, see
+// Layout.Wrap(). the zero value adds nothing
+type Layout struct {
+	Title string       // shown as the page's "#" heading, "" for none
+	Nav   []LayoutLink // link lines under the title
+	// text shown at the bottom of every page (eg. "Generated by mycapsule"), "" for none
+	Footer string
+	// if set, the footer also says when the page was generated
+	Timestamp bool
+}
+
+// returns a new body with page placed between the layout's header & footer
+func (layout *Layout) Wrap(page *GeminiBody) *GeminiBody {
+	body := NewBody()
+	if layout.Title != "" {
+		body.AddHeader(layout.Title)
+	}
+	if len(layout.Nav) > 0 {
+		for _, link := range layout.Nav {
+			body.addLink(link.URL, link.Text)
+		}
+		body.buf.WriteByte('\n')
+	}
+
+	body.Append(page)
+
+	footer := layout.Footer
+	if layout.Timestamp {
+		if footer != "" {
+			footer += " · "
+		}
+		footer += "page generated " + time.Now().UTC().Format("2006-01-02 15:04 UTC")
+	}
+	if footer != "" {
+		body.AddTextLine("--")
+		body.AddTextLine(footer)
+	}
+
+	return body
+}
+
+// sends page wrapped in the layout (can panic !)
+func (layout *Layout) SendPage(peer *GeminiPeer, page *GeminiBody) {
+	peer.layout = nil // don't wrap the page twice, see Middleware()
+	peer.SendBody(layout.Wrap(page))
+}
+
+// returns a middleware that wraps every body sent with SendBody() or SendBodyLang() by
+// the handlers behind it in the layout. other responses (eg. files sent with
+// SendSuccess()) are left alone
+func (layout *Layout) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(peer *GeminiPeer) {
+			peer.layout = layout
+			next.ServeGemini(peer)
+		})
+	}
+}
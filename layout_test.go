@@ -0,0 +1,21 @@
+package gemini
+
+import "testing"
+
+func TestLayoutNavLinks(t *testing.T) {
+	layout := &Layout{
+		Title: "capsule",
+		Nav: []LayoutLink{
+			{URL: "/", Text: "home"},
+			{URL: "/a\n=> evil", Text: "about\n# injected"},
+		},
+	}
+
+	page := NewBody()
+	page.AddTextLine("hi")
+
+	want := "# capsule\n\n=> / home\n=> /a%0A=> evil about # injected\n\nhi\n\n"
+	if got := layout.Wrap(page).String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
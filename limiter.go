@@ -0,0 +1,74 @@
+package gemini
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/* ======================================[[ Host Limiter ]]======================================= */
+
+// spaces out a Client's requests to the same host, so automated tools (crawlers, feed
+// readers, mirrors) are good citizens, see Client.HostLimiter. the zero value allows one
+// request per host at a time, with no delay between them. it may be shared by clients
+type HostLimiter struct {
+	Interval      time.Duration // minimum time between the starts of two requests to a host
+	MaxConcurrent int           // requests to a host at once, 0 for 1
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+type hostSlot struct {
+	sem  chan struct{}
+	next time.Time // when the next request may start
+}
+
+// waits for host's turn, returning a func to call once the request is done with (its
+// body closed). fails with ctx.Err() if ctx ends first
+func (limiter *HostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	limiter.mu.Lock()
+	if limiter.hosts == nil {
+		limiter.hosts = map[string]*hostSlot{}
+	}
+	slot, exists := limiter.hosts[host]
+	if !exists {
+		maxConcurrent := limiter.MaxConcurrent
+		if maxConcurrent <= 0 {
+			maxConcurrent = 1
+		}
+		slot = &hostSlot{sem: make(chan struct{}, maxConcurrent)}
+		limiter.hosts[host] = slot
+	}
+	limiter.mu.Unlock()
+
+	select {
+	case slot.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-slot.sem }
+
+	// claim the next start time, then wait for it
+	limiter.mu.Lock()
+	now := time.Now()
+	start := slot.next
+	if start.Before(now) {
+		start = now
+	}
+	slot.next = start.Add(limiter.Interval)
+	limiter.mu.Unlock()
+
+	if wait := time.Until(start); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+
+	return release, nil
+}
@@ -0,0 +1,111 @@
+package gemini
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+/* =====================================[[ Gemtext Linter ]]====================================== */
+
+// a problem found by a GemtextLinter
+type GemtextIssue struct {
+	Line    int // 1-based
+	Message string
+}
+
+func (issue GemtextIssue) String() string {
+	return fmt.Sprintf("line %d: %s", issue.Line, issue.Message)
+}
+
+// checks gemtext (eg. generated pages in tests, or files in a static site pipeline) for
+// problems. the zero value is ready to use
+type GemtextLinter struct {
+	// lines wider than this many columns (see StringWidth()) are reported, 0 to allow
+	// any width
+	MaxLineLength int
+}
+
+// reads the gemtext document from r and returns the problems found in it: unclosed
+// preformatted blocks, link lines without a (valid) url, invalid UTF-8, lines ending
+// differently than the first line does (CRLF vs. LF), stray CRs and overlong lines
+func (linter *GemtextLinter) Lint(r io.Reader) ([]GemtextIssue, error) {
+	var issues []GemtextIssue
+	report := func(line int, format string, args ...any) {
+		issues = append(issues, GemtextIssue{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	firstEnding := ""
+	preStart := 0 // line the open preformatted block starts at, 0 if none
+	reader := bufio.NewReader(r)
+	for pos := 1; ; pos++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && line == "" {
+			break
+		}
+
+		// the last line may have no ending at all, which is fine
+		ending := ""
+		if strings.HasSuffix(line, "\r\n") {
+			ending = "CRLF"
+		} else if strings.HasSuffix(line, "\n") {
+			ending = "LF"
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if ending != "" {
+			if firstEnding == "" {
+				firstEnding = ending
+			} else if ending != firstEnding {
+				report(pos, "line ends with %s, earlier lines end with %s", ending, firstEnding)
+			}
+		}
+		if strings.ContainsRune(line, '\r') {
+			report(pos, "stray carriage return")
+		}
+
+		if !utf8.ValidString(line) {
+			report(pos, "invalid UTF-8")
+		} else if width := StringWidth(line); linter.MaxLineLength > 0 && width > linter.MaxLineLength {
+			report(pos, "line is %d columns wide, the limit is %d", width, linter.MaxLineLength)
+		}
+
+		switch {
+		case strings.HasPrefix(line, "```"):
+			if preStart == 0 {
+				preStart = pos
+			} else {
+				preStart = 0
+			}
+		case preStart != 0:
+		case strings.HasPrefix(line, "=>"):
+			fields := strings.Fields(line[2:])
+			if len(fields) == 0 {
+				report(pos, "link line has no url")
+			} else if _, err := url.Parse(fields[0]); err != nil {
+				report(pos, "link line has a malformed url '%s'", fields[0])
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if preStart != 0 {
+		report(preStart, "preformatted block is never closed")
+	}
+	return issues, nil
+}
+
+// lints the gemtext document src with the default linter, see GemtextLinter.Lint()
+func LintGemtext(src string) []GemtextIssue {
+	issues, _ := (&GemtextLinter{}).Lint(strings.NewReader(src)) // can't fail reading a string
+	return issues
+}
@@ -0,0 +1,289 @@
+package gemini
+
+import (
+	"regexp"
+	"strings"
+)
+
+/* ========================================[[ Markdown ]]========================================= */
+
+var (
+	mdRefDef     = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:\s*<?([^\s>]+)>?(?:\s+["'(].*["')])?\s*$`)
+	mdATXHeading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	mdRule       = regexp.MustCompile(`^ {0,3}([-*_])(?:\s*([-*_])){2,}\s*$`)
+	mdFence      = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([^`\\s]*)")
+	mdListItem   = regexp.MustCompile(`^\s*(?:[-*+]|\d{1,9}[.)])\s+(.*)$`)
+	mdQuote      = regexp.MustCompile(`^ {0,3}>\s?(.*)$`)
+	mdSetext1    = regexp.MustCompile(`^ {0,3}=+\s*$`)
+	mdSetext2    = regexp.MustCompile(`^ {0,3}-+\s*$`)
+
+	mdCodeSpan = regexp.MustCompile("(`+)(.+?)`+")
+	mdImage    = regexp.MustCompile(`!\[([^\]]*)\]\(\s*<?([^\s)>]*)>?(?:\s+["'(][^)]*["')])?\s*\)`)
+	mdLink     = regexp.MustCompile(`\[([^\]]+)\]\(\s*<?([^\s)>]*)>?(?:\s+["'(][^)]*["')])?\s*\)`)
+	mdRefLink  = regexp.MustCompile(`\[([^\]]+)\](?:\[([^\]]*)\])?`)
+	mdAutolink = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9+.-]*:[^\s<>]+)>`)
+	mdStrong   = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdEmph     = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:.*?\S)?)[*_]([^\w*]|$)`)
+	mdStrike   = regexp.MustCompile(`~~(.+?)~~`)
+	mdEscape   = regexp.MustCompile("\\\\([!-/:-@\\[-`{-~])")
+)
+
+// escaped punctuation (eg. "\*") is swapped for a private use character while the inline
+// markup is converted, so it can't be mistaken for markup
+const mdEscapeBase = 0xE000
+
+// a link found inside a block, emitted as a link line after the block (gemtext has no
+// inline links)
+type pendingLink struct {
+	url, text string
+}
+
+// converts markdown to gemtext
+type mdConverter struct {
+	body      *GeminiBody
+	refs      map[string]string // reference definitions, by lowercased label
+	paragraph []string
+	links     []pendingLink // links of the block being converted
+}
+
+// converts the inline markup of text to plain text, collecting its links
+func (conv *mdConverter) inline(text string) string {
+	var out strings.Builder
+
+	// code spans are copied as-is, everything around them is converted
+	for {
+		loc := mdCodeSpan.FindStringSubmatchIndex(text)
+		if loc == nil {
+			break
+		}
+
+		out.WriteString(conv.inlineText(text[:loc[0]]))
+		out.WriteString(strings.TrimSpace(text[loc[4]:loc[5]]))
+		text = text[loc[1]:]
+	}
+	out.WriteString(conv.inlineText(text))
+
+	return out.String()
+}
+
+func (conv *mdConverter) inlineText(text string) string {
+	text = mdEscape.ReplaceAllStringFunc(text, func(match string) string {
+		return string(rune(mdEscapeBase + int(match[1])))
+	})
+
+	text = mdImage.ReplaceAllStringFunc(text, func(match string) string {
+		sub := mdImage.FindStringSubmatch(match)
+		alt := sub[1]
+		if alt == "" {
+			alt = "image"
+		}
+		conv.links = append(conv.links, pendingLink{url: sub[2], text: alt})
+		return alt
+	})
+
+	text = mdLink.ReplaceAllStringFunc(text, func(match string) string {
+		sub := mdLink.FindStringSubmatch(match)
+		label := conv.inlineText(sub[1])
+		conv.links = append(conv.links, pendingLink{url: sub[2], text: label})
+		return label
+	})
+
+	text = mdRefLink.ReplaceAllStringFunc(text, func(match string) string {
+		sub := mdRefLink.FindStringSubmatch(match)
+		ref := sub[2]
+		if ref == "" {
+			ref = sub[1]
+		}
+
+		url, exists := conv.refs[strings.ToLower(ref)]
+		if !exists {
+			return match
+		}
+
+		label := conv.inlineText(sub[1])
+		conv.links = append(conv.links, pendingLink{url: url, text: label})
+		return label
+	})
+
+	text = mdAutolink.ReplaceAllStringFunc(text, func(match string) string {
+		url := match[1 : len(match)-1]
+		conv.links = append(conv.links, pendingLink{url: url, text: url})
+		return url
+	})
+
+	text = mdStrong.ReplaceAllString(text, "$2")
+	text = mdEmph.ReplaceAllString(text, "$1$2$3")
+	text = mdStrike.ReplaceAllString(text, "$1")
+	return strings.Map(func(r rune) rune {
+		if r >= mdEscapeBase && r < mdEscapeBase+0x80 {
+			return r - mdEscapeBase
+		}
+		return r
+	}, text)
+}
+
+// emits the links collected from the block that was just converted
+func (conv *mdConverter) flushLinks() {
+	for _, link := range conv.links {
+		conv.body.AddSafeLinkLine(link.url, link.text)
+	}
+	conv.links = nil
+}
+
+func (conv *mdConverter) flushParagraph() {
+	if len(conv.paragraph) == 0 {
+		return
+	}
+
+	// gemtext lines are wrapped by the client, so the paragraph becomes a single line
+	text := conv.inline(strings.Join(conv.paragraph, " "))
+	conv.paragraph = nil
+
+	conv.body.AddTextLine(EscapeText(text))
+	conv.flushLinks()
+}
+
+func (conv *mdConverter) heading(level int, text string) {
+	text = EscapeText(conv.inline(text))
+	switch level {
+	case 1:
+		conv.body.AddHeader(text)
+	case 2:
+		conv.body.AddSubHeader(text)
+	default: // gemtext has no deeper levels
+		conv.body.AddSubSubHeader(text)
+	}
+	conv.flushLinks()
+}
+
+// converts the lines of a markdown document
+func (conv *mdConverter) convert(lines []string) {
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			conv.flushParagraph()
+
+		case mdFence.MatchString(line):
+			conv.flushParagraph()
+			fence := mdFence.FindStringSubmatch(line)
+			var code []string
+			for i++; i < len(lines); i++ {
+				if trimmed := strings.TrimSpace(lines[i]); strings.HasPrefix(trimmed, fence[1]) && strings.Trim(trimmed, fence[1][:1]) == "" {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			conv.body.AddPreformatted(fence[2], strings.Join(code, "\n"))
+
+		case len(conv.paragraph) > 0 && mdSetext1.MatchString(line):
+			text := strings.Join(conv.paragraph, " ")
+			conv.paragraph = nil
+			conv.heading(1, text)
+
+		case len(conv.paragraph) > 0 && mdSetext2.MatchString(line):
+			text := strings.Join(conv.paragraph, " ")
+			conv.paragraph = nil
+			conv.heading(2, text)
+
+		case mdRule.MatchString(line):
+			// gemtext has no rules, the blank line around them is enough
+			conv.flushParagraph()
+
+		case mdATXHeading.MatchString(line):
+			conv.flushParagraph()
+			sub := mdATXHeading.FindStringSubmatch(line)
+			conv.heading(len(sub[1]), sub[2])
+
+		case len(conv.paragraph) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			// indented code block, runs until a line that isn't indented (or blank)
+			var code []string
+			for ; i < len(lines); i++ {
+				if l := lines[i]; strings.HasPrefix(l, "    ") {
+					code = append(code, l[4:])
+				} else if strings.HasPrefix(l, "\t") {
+					code = append(code, l[1:])
+				} else if strings.TrimSpace(l) == "" {
+					code = append(code, "")
+				} else {
+					break
+				}
+			}
+			i--
+
+			// trailing blank lines belong to the document, not the block
+			for len(code) > 0 && code[len(code)-1] == "" {
+				code = code[:len(code)-1]
+			}
+			conv.body.AddPreformatted("", strings.Join(code, "\n"))
+
+		case mdListItem.MatchString(line):
+			conv.flushParagraph()
+			for ; i < len(lines); i++ {
+				sub := mdListItem.FindStringSubmatch(lines[i])
+				if sub == nil {
+					break
+				}
+
+				// lazy continuation lines belong to the item
+				item := sub[1]
+				for i+1 < len(lines) && strings.HasPrefix(lines[i+1], "  ") && !mdListItem.MatchString(lines[i+1]) {
+					i++
+					item += " " + strings.TrimSpace(lines[i])
+				}
+				conv.body.AddListItem(conv.inline(item))
+			}
+			i--
+			conv.body.AddRaw("\n")
+			conv.flushLinks()
+
+		case mdQuote.MatchString(line):
+			conv.flushParagraph()
+			var quote []string
+			for ; i < len(lines); i++ {
+				sub := mdQuote.FindStringSubmatch(lines[i])
+				if sub == nil {
+					break
+				}
+				quote = append(quote, conv.inline(sub[1]))
+			}
+			i--
+			conv.body.AddQuote(strings.Join(quote, "\n"))
+			conv.flushLinks()
+
+		default:
+			conv.paragraph = append(conv.paragraph, strings.TrimSpace(line))
+		}
+	}
+
+	conv.flushParagraph()
+}
+
+// converts markdown (CommonMark, more or less) to gemtext and adds it to the body.
+// headings deeper than "###" are flattened to "###", lists & quotes are kept, fenced
+// and indented code becomes preformatted blocks (the fence's info string as alt text).
+// inline markup is stripped, and links & images found in a paragraph, list or quote are
+// added as link lines right after it. raw HTML is passed through as text
+func (body *GeminiBody) AddMarkdown(markdown string) {
+	conv := &mdConverter{body: body, refs: map[string]string{}}
+
+	// reference definitions can appear anywhere, so they're collected first
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n") {
+		if sub := mdRefDef.FindStringSubmatch(line); sub != nil {
+			conv.refs[strings.ToLower(sub[1])] = sub[2]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	conv.convert(lines)
+}
+
+// converts markdown to gemtext, see GeminiBody.AddMarkdown()
+func MarkdownToGemtext(markdown string) string {
+	body := NewBody()
+	body.AddMarkdown(markdown)
+	return body.String()
+}
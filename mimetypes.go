@@ -0,0 +1,75 @@
+package gemini
+
+import (
+	"mime"
+	"path"
+	"strings"
+)
+
+/* ======================================[[ MIME Types ]]======================================== */
+
+// extension -> mime type table consulted before falling back to mime.TypeByExtension()
+var defaultMimeTypes = map[string]string{
+	".gmi":    "text/gemini",
+	".gemini": "text/gemini",
+}
+
+// lowercases ext and makes sure it starts with a '.'
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	return ext
+}
+
+// returns the mime type for name based on its extension. unknown extensions are
+// reported as "application/octet-stream"
+func MimeType(name string) string {
+	ext := normalizeExt(path.Ext(name))
+	if typ, exists := defaultMimeTypes[ext]; exists {
+		return typ
+	}
+
+	if typ := mime.TypeByExtension(ext); typ != "" {
+		return typ
+	}
+
+	return "application/octet-stream"
+}
+
+// overrides the mime type reported for files with the extension ext (eg. ".txt" or "txt")
+// served by this server
+func (server *GeminiServer) AddMimeType(ext, mimeType string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if server.mimeTypes == nil {
+		server.mimeTypes = map[string]string{}
+	}
+
+	server.mimeTypes[normalizeExt(ext)] = mimeType
+}
+
+// drops every override added by AddMimeType(), eg. before applying a reloaded config
+func (server *GeminiServer) ClearMimeTypes() {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.mimeTypes = nil
+}
+
+// same as MimeType(), but respects the server's overrides
+func (server *GeminiServer) mimeType(name string) string {
+	if server != nil {
+		server.mu.RLock()
+		defer server.mu.RUnlock()
+
+		if typ, exists := server.mimeTypes[normalizeExt(path.Ext(name))]; exists {
+			return typ
+		}
+	}
+
+	return MimeType(name)
+}
@@ -0,0 +1,123 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+/* =======================================[[ Fetch Pool ]]======================================== */
+
+// the outcome of fetching one of a FetchPool's urls
+type FetchResult struct {
+	URL      string
+	Response *Response // its body was read in full, and can be read again from memory
+	Err      error
+}
+
+// fetches many urls at once (eg. the feeds of an aggregator) with a bounded number of
+// workers, making at most PerHost requests to the same host at a time
+type FetchPool struct {
+	Client  Fetcher // nil uses DefaultClient
+	Workers int     // 0 for 4
+	PerHost int     // 0 for 1
+}
+
+// returns the key requests are limited per host by
+func poolHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Host)
+}
+
+// fetches urls, sending a result per url on the returned channel as they complete (in
+// no particular order). the channel is closed once every url is done. cancelling ctx
+// fails the requests that haven't completed yet
+func (pool *FetchPool) FetchAll(ctx context.Context, urls []string) <-chan FetchResult {
+	var client Fetcher = DefaultClient
+	if pool.Client != nil {
+		client = pool.Client
+	}
+	workers, perHost := pool.Workers, pool.PerHost
+	if workers <= 0 {
+		workers = 4
+	}
+	if perHost <= 0 {
+		perHost = 1
+	}
+
+	// buffered so workers never wait on a slow reader
+	results := make(chan FetchResult, len(urls))
+	queue := append([]string{}, urls...)
+	inFlight := map[string]int{}
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+
+	// takes the first queued url whose host isn't at its limit, waiting for one if need
+	// be. returns false once the queue is empty
+	next := func() (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for len(queue) > 0 {
+			for i, rawURL := range queue {
+				if host := poolHost(rawURL); inFlight[host] < perHost {
+					queue = append(queue[:i], queue[i+1:]...)
+					inFlight[host]++
+					return rawURL, true
+				}
+			}
+			cond.Wait()
+		}
+		return "", false
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(urls); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				rawURL, ok := next()
+				if !ok {
+					return
+				}
+
+				results <- fetchBuffered(ctx, client, rawURL)
+
+				mu.Lock()
+				inFlight[poolHost(rawURL)]--
+				cond.Broadcast()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// fetches rawURL, reading the body into memory so the connection can be closed
+func fetchBuffered(ctx context.Context, client Fetcher, rawURL string) FetchResult {
+	resp, err := client.FetchContext(ctx, rawURL)
+	if err != nil {
+		return FetchResult{URL: rawURL, Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return FetchResult{URL: rawURL, Response: resp, Err: err}
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return FetchResult{URL: rawURL, Response: resp}
+}
@@ -0,0 +1,213 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/* =====================================[[ PROXY Protocol ]]====================================== */
+
+// v2 headers start with this signature, see
+//
+//	https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1 headers can't be longer than this, <CR><LF> included
+const proxyV1MaxLength = 107
+
+// accepts connections, marking those coming from a trusted proxy so their PROXY header
+// is parsed before the TLS handshake
+type proxyListener struct {
+	net.Listener
+	server *GeminiServer
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil || !l.server.isTrustedProxy(conn.RemoteAddr()) {
+		return conn, err
+	}
+
+	return &proxyConn{Conn: conn, reader: bufio.NewReaderSize(conn, proxyV1MaxLength+1)}, nil
+}
+
+// a connection from a trusted proxy. the header is parsed on the first Read() (ie. during
+// the handshake, bound by the request timeout) rather than in Accept() so a slow proxy
+// can't stall the accept loop
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	mu     sync.Mutex
+	remote net.Addr // real client address, nil until the header was parsed (or if it had none)
+	err    error
+}
+
+func (conn *proxyConn) Read(p []byte) (int, error) {
+	conn.once.Do(func() {
+		remote, err := readProxyHeader(conn.reader)
+
+		conn.mu.Lock()
+		conn.remote, conn.err = remote, err
+		conn.mu.Unlock()
+	})
+
+	if conn.err != nil {
+		return 0, conn.err
+	}
+	return conn.reader.Read(p)
+}
+
+// returns the real client address once the PROXY header has been read, the proxy's own
+// address before that (or if the proxy didn't know the client's)
+func (conn *proxyConn) RemoteAddr() net.Addr {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.remote != nil {
+		return conn.remote
+	}
+	return conn.Conn.RemoteAddr()
+}
+
+// half-closes the connection to the proxy, see GeminiPeer.Close()
+func (conn *proxyConn) CloseWrite() error {
+	if tcpConn, ok := conn.Conn.(*net.TCPConn); ok {
+		return tcpConn.CloseWrite()
+	}
+	return nil
+}
+
+// reads a v1 or v2 PROXY header, returning the client address it carries. connections
+// starting with anything else (eg. a TLS ClientHello) are left as is, returning nil
+func readProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case 'P':
+		return readProxyV1(reader)
+	case proxyV2Signature[0]:
+		return readProxyV2(reader)
+	default:
+		return nil, nil
+	}
+}
+
+// eg. "PROXY TCP4 192.0.2.1 198.51.100.1 56324 1965\r\n"
+func readProxyV1(reader *bufio.Reader) (net.Addr, error) {
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		return nil, fmt.Errorf("malformed PROXY v1 header: %w", err)
+	}
+
+	if !bytes.HasPrefix(line, []byte("PROXY ")) || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("malformed PROXY v1 header")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("malformed PROXY v1 header")
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, errors.New("malformed PROXY v1 header address")
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// a 16 byte header (signature, version & command, family, length) followed by the
+// addresses
+func readProxyV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("malformed PROXY v2 header: %w", err)
+	}
+
+	if !bytes.Equal(header[:12], proxyV2Signature) || header[12]>>4 != 2 {
+		return nil, errors.New("malformed PROXY v2 header")
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, fmt.Errorf("malformed PROXY v2 header: %w", err)
+	}
+
+	// LOCAL connections (eg. health checks from the proxy itself) carry no client
+	if header[12]&0xF != 1 {
+		return nil, nil
+	}
+
+	switch family := header[13] >> 4; {
+	case family == 1 && len(body) >= 12: // AF_INET
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case family == 2 && len(body) >= 36: // AF_INET6
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// trusts connections from sources (IPs or CIDR ranges, eg. "127.0.0.1" or "10.0.0.0/8")
+// to start with a PROXY protocol (v1 or v2) header naming the real client. once it's
+// read, the peer's GetAddr() (and so logs, rate limiting, CGI's REMOTE_ADDR, etc.) reports
+// the client rather than the proxy. connections from anywhere else are never parsed.
+// calling it again replaces the list, nothing is trusted by default
+func (server *GeminiServer) SetTrustedProxies(sources ...string) error {
+	trusted := make([]*net.IPNet, 0, len(sources))
+	for _, source := range sources {
+		if !strings.Contains(source, "/") {
+			if ip := net.ParseIP(source); ip != nil && ip.To4() != nil {
+				source += "/32"
+			} else {
+				source += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(source)
+		if err != nil {
+			return fmt.Errorf("bad trusted proxy '%s': %w", source, err)
+		}
+		trusted = append(trusted, ipNet)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.trustedProxies = trusted
+	return nil
+}
+
+func (server *GeminiServer) isTrustedProxy(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	for _, ipNet := range server.trustedProxies {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package gemini
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+/* ======================================[[ Rate Limiting ]]====================================== */
+
+// picks the key peers are rate limited by, peers sharing a key share a limit
+type RateLimitKey func(peer *GeminiPeer) string
+
+// rate limits peers by their remote IP
+func RateLimitByIP(peer *GeminiPeer) string {
+	addr := peer.GetAddr()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// rate limits peers by the fingerprint of their client certificate. peers without one are
+// rate limited by their remote IP
+func RateLimitByCert(peer *GeminiPeer) string {
+	if cert := peer.ClientCert(); cert != nil {
+		return Fingerprint(cert)
+	}
+
+	return RateLimitByIP(peer)
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	requests  int
+	per       time.Duration
+	key       RateLimitKey
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// returns the bucket for key, dropping buckets that have been idle long enough to refill
+// (tracking them would be pointless)
+func (rl *rateLimiter) bucket(key string) *tokenBucket {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.lastSweep) > rl.per {
+		for k, tb := range rl.buckets {
+			tb.mu.Lock()
+			idle := now.Sub(tb.last) > rl.per
+			tb.mu.Unlock()
+
+			if idle {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	tb, exists := rl.buckets[key]
+	if !exists {
+		burst := float64(rl.requests)
+		tb = &tokenBucket{rate: burst / rl.per.Seconds(), burst: burst, tokens: burst, last: now}
+		rl.buckets[key] = tb
+	}
+
+	return tb
+}
+
+// middleware that allows each key (see RateLimitByIP & RateLimitByCert) at most requests
+// requests per duration, bursts included. peers over the limit are answered with
+// StatusSlowDown and how many seconds until they may try again. each call creates a
+// separate limit, so wrap each route (or group) that should be limited on its own. eg:
+//
+//	router.Handle("/search", gemini.RateLimit(5, time.Minute, gemini.RateLimitByIP)(search))
+//
+// requests and per must both be positive (can panic !)
+func RateLimit(requests int, per time.Duration, key RateLimitKey) Middleware {
+	if requests <= 0 || per <= 0 {
+		panic(fmt.Errorf("RateLimit: bad limit of %d requests per %s", requests, per))
+	}
+
+	if key == nil {
+		key = RateLimitByIP
+	}
+
+	rl := &rateLimiter{
+		requests:  requests,
+		per:       per,
+		key:       key,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(peer *GeminiPeer) {
+			if ok, delay := rl.bucket(rl.key(peer)).take(1); !ok {
+				peer.SendSlowDown(int(math.Ceil(delay.Seconds())))
+				return
+			}
+
+			next.ServeGemini(peer)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package gemini
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	router := NewHandler()
+	router.Use(RateLimit(2, time.Hour, func(peer *GeminiPeer) string { return "everyone" }))
+	router.AddHandler("/", named("ok"))
+
+	checkRoutes(t, router, []routeTest{
+		{"/", "10 ok"},
+		{"/", "10 ok"},
+		{"/", "44 1800"},
+	})
+}
+
+func TestRateLimitBadLimit(t *testing.T) {
+	tests := []struct {
+		requests int
+		per      time.Duration
+	}{
+		{0, time.Minute},
+		{-1, time.Minute},
+		{5, 0},
+		{5, -time.Second},
+	}
+
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RateLimit(%d, %s) didn't panic", test.requests, test.per)
+				}
+			}()
+			RateLimit(test.requests, test.per, nil)
+		}()
+	}
+}
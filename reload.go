@@ -0,0 +1,58 @@
+package gemini
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+/* ========================================[[ Reloading ]]======================================== */
+
+// registers fn to be called by Reload(). fn can swap the server's handler (SetHandler()),
+// change limits, etc. to pick up a new configuration
+func (server *GeminiServer) OnReload(fn func(server *GeminiServer) error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.reloaders = append(server.reloaders, fn)
+}
+
+// reloads the certificates from disk and calls every function registered with OnReload().
+// connections that are already being handled are unaffected. returns the first error
+// encountered, the remaining functions are still called
+func (server *GeminiServer) Reload() error {
+	var firstErr error
+	if err := server.loadCertificates(); err != nil {
+		log.Print("Reload: certificate: ", err)
+		firstErr = err
+	}
+
+	server.mu.RLock()
+	reloaders := server.reloaders
+	server.mu.RUnlock()
+
+	for _, reload := range reloaders {
+		if err := reload(server); err != nil {
+			log.Print("Reload: ", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// calls Reload() every time the process receives a SIGHUP
+func (server *GeminiServer) ReloadOnSIGHUP() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		for range sigs {
+			log.Print("SIGHUP received, reloading")
+			server.Reload()
+		}
+	}()
+}
@@ -0,0 +1,123 @@
+package gemini
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"math/rand"
+	"net/url"
+	"time"
+)
+
+/* =========================================[[ Retries ]]========================================= */
+
+// when & how often a Client retries failed requests, see Client.Retry. the zero value
+// retries up to 3 times, starting at a 500ms delay
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per request, including the first one. 0 for 3
+	BaseDelay   time.Duration // delay before the first retry, doubled for each one after. 0 for 500ms
+	MaxDelay    time.Duration // cap on the delay between attempts. 0 for 30s
+
+	// if set, temporary failures (40 - 44) are returned as-is instead of retried
+	NoRetryStatus bool
+}
+
+// wraps failures to connect or complete the TLS handshake, which may be worth retrying.
+// the error reads the same as the one it wraps
+type connectError struct {
+	err error
+}
+
+func (err *connectError) Error() string { return err.err.Error() }
+func (err *connectError) Unwrap() error { return err.err }
+
+// reports whether a dial or handshake error might go away on its own. certificates that
+// failed to verify won't
+func isTransientConnectError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return !errors.As(err, &unknownAuthority) && !errors.As(err, &hostname) && !errors.As(err, &invalid)
+}
+
+// returns the delay before the given retry (1 for the first), exponential with jitter
+func (policy *RetryPolicy) delay(retry int) time.Duration {
+	base, maxDelay := policy.BaseDelay, policy.MaxDelay
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+
+	delay := base
+	for i := 1; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	// anywhere between half and the full delay, so clients don't retry in lockstep
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// decides whether the attempt'th attempt (1 for the first) should be retried, and after
+// how long
+func (policy *RetryPolicy) shouldRetry(attempt int, resp *Response, err error) (time.Duration, bool) {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	if attempt >= maxAttempts {
+		return 0, false
+	}
+
+	var connErr *connectError
+	switch {
+	case err != nil:
+		return policy.delay(attempt), errors.As(err, &connErr)
+	case !resp.IsTempFailure() || policy.NoRetryStatus:
+		return 0, false
+	case resp.Status == StatusSlowDown:
+		// wait as long as the server asks, unless that's longer than we'd ever wait
+		slowDown := resp.Err().(*ErrSlowDown)
+		if slowDown.Seconds <= 0 {
+			return policy.delay(attempt), true
+		}
+
+		delay := time.Duration(slowDown.Seconds) * time.Second
+		if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+			return 0, false
+		}
+		return delay, true
+	default:
+		return policy.delay(attempt), true
+	}
+}
+
+// makes a single request for reqURL, retrying it as Client.Retry allows
+func (client *Client) fetchRetrying(ctx context.Context, via string, reqURL *url.URL) (*Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := client.fetch(ctx, via, reqURL, nil)
+		if client.Retry == nil {
+			return resp, err
+		}
+
+		delay, retry := client.Retry.shouldRetry(attempt, resp, err)
+		if !retry {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
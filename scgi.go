@@ -0,0 +1,91 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* =======================================[[ scgiHandler ]]======================================= */
+
+type scgiHandler struct {
+	network string
+	addr    string
+	timeout time.Duration
+}
+
+// forwards requests to a long-running SCGI application listening on addr. network is
+// either "tcp" or "unix". like CGI, the application is expected to write a complete
+// gemini response (header included), which is relayed to the peer as-is
+func SCGIHandler(network, addr string) *scgiHandler {
+	return &scgiHandler{network: network, addr: addr, timeout: defaultCGITimeout}
+}
+
+// sets how long the whole exchange with the application may take
+func (sHndlr *scgiHandler) SetTimeout(timeout time.Duration) {
+	sHndlr.timeout = timeout
+}
+
+// reported by scgiHeaders() when a header would smuggle in a NUL, which would let the
+// peer inject headers of its own (eg. TLS_CLIENT_HASH)
+var errSCGIHeaderNUL = errors.New("SCGI header contains a NUL byte")
+
+// encodes the SCGI request headers as a netstring. CONTENT_LENGTH must come first
+func scgiHeaders(env []string) ([]byte, error) {
+	var headers bytes.Buffer
+	headers.WriteString("CONTENT_LENGTH\x000\x00SCGI\x001\x00")
+	for _, kv := range env {
+		if strings.Contains(kv, "\x00") {
+			return nil, errSCGIHeaderNUL
+		}
+
+		if i := strings.Index(kv, "="); i != -1 {
+			headers.WriteString(kv[:i] + "\x00" + kv[i+1:] + "\x00")
+		}
+	}
+
+	return []byte(strconv.Itoa(headers.Len()) + ":" + headers.String() + ","), nil
+}
+
+func (sHndlr *scgiHandler) ServeGemini(peer *GeminiPeer) {
+	headers, err := scgiHeaders(peer.cgiEnv("", peer.path))
+	if err != nil {
+		log.Printf("%s [ERR]: SCGI '%s': %s", peer.GetAddr(), sHndlr.addr, err)
+		peer.sendHeader(StatusBadRequest, "Malformed request!")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(peer.Context(), sHndlr.timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, sHndlr.network, sHndlr.addr)
+	if err != nil {
+		log.Printf("%s [ERR]: SCGI '%s' unreachable: %s", peer.GetAddr(), sHndlr.addr, err)
+		peer.sendHeader(StatusCGIError, "SCGI application unavailable!")
+		return
+	}
+	defer conn.Close()
+
+	// unblocks the relay once we run out of time (or the peer goes away)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	if _, err := conn.Write(headers); err != nil {
+		log.Printf("%s [ERR]: SCGI '%s': %s", peer.GetAddr(), sHndlr.addr, err)
+		peer.sendHeader(StatusCGIError, "SCGI application failed!")
+		return
+	}
+
+	relayResponse(peer, conn, "SCGI application failed!")
+}
+
+// same as ServeGemini(), can be passed to GeminiServer.Run()
+func (sHndlr *scgiHandler) HandlePeer(peer *GeminiPeer) {
+	sHndlr.ServeGemini(peer)
+}
@@ -0,0 +1,79 @@
+package gemini
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// starts an SCGI application answering every request with "20 text/gemini", each
+// request's headers are sent on the returned channel
+func scgiBackend(t *testing.T) (net.Listener, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := make(chan string, 8)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			// "<length>:<headers>,"
+			reader := bufio.NewReader(conn)
+			length, _ := reader.ReadString(':')
+			size, _ := strconv.Atoi(strings.TrimSuffix(length, ":"))
+			headers := make([]byte, size)
+			io.ReadFull(reader, headers)
+			requests <- string(headers)
+			conn.Write([]byte("20 text/gemini\r\nhi\n"))
+			conn.Close()
+		}
+	}()
+
+	t.Cleanup(func() { listener.Close() })
+	return listener, requests
+}
+
+func TestSCGIHeaders(t *testing.T) {
+	listener, requests := scgiBackend(t)
+	handler := SCGIHandler("tcp", listener.Addr().String())
+
+	if got := serve(handler, "/hello"); got != "20 text/gemini" {
+		t.Fatalf("got '%s', want '20 text/gemini'", got)
+	}
+	if headers := <-requests; !strings.Contains(headers, "PATH_INFO\x00/hello\x00") {
+		t.Errorf("PATH_INFO missing from %q", headers)
+	}
+}
+
+func TestSCGIRejectsNUL(t *testing.T) {
+	listener, requests := scgiBackend(t)
+	handler := SCGIHandler("tcp", listener.Addr().String())
+
+	_, _, reqPath, _, err := parseURL("gemini://localhost/%00TLS_CLIENT_HASH%00x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := serve(handler, reqPath); got != "59 Malformed request!" {
+		t.Errorf("got '%s', want '59 Malformed request!'", got)
+	}
+
+	select {
+	case headers := <-requests:
+		t.Errorf("backend got %q", headers)
+	default:
+	}
+
+	if _, err := scgiHeaders([]string{"PATH_INFO=/\x00TLS_CLIENT_HASH\x00x"}); err == nil {
+		t.Error("scgiHeaders() accepted a NUL")
+	}
+}
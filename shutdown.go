@@ -0,0 +1,108 @@
+package gemini
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/* ========================================[[ Shutdown ]]========================================= */
+
+// starts counting peer as active, reports false if the server is draining (and peer
+// wasn't tracked)
+func (server *GeminiServer) track(peer *GeminiPeer) bool {
+	server.peersMu.Lock()
+	defer server.peersMu.Unlock()
+
+	// active.Add() mustn't race drain()'s active.Wait()
+	if server.draining {
+		return false
+	}
+
+	if server.peers == nil {
+		server.peers = map[*GeminiPeer]struct{}{}
+	}
+
+	server.peers[peer] = struct{}{}
+	server.active.Add(1)
+	return true
+}
+
+func (server *GeminiServer) untrack(peer *GeminiPeer) {
+	server.peersMu.Lock()
+	defer server.peersMu.Unlock()
+
+	if _, exists := server.peers[peer]; exists {
+		delete(server.peers, peer)
+		server.active.Done()
+	}
+}
+
+// stops accepting new connections and waits for the active ones to finish, after which
+// Run() returns. if ctx expires first, the remaining connections are closed forcefully
+// and ctx's error is returned
+func (server *GeminiServer) Shutdown(ctx context.Context) error {
+	return server.shutdown(ctx, nil)
+}
+
+func (server *GeminiServer) shutdown(ctx context.Context, onExit func()) error {
+	server.shuttingDown.Store(true)
+	server.listenSock.Close()
+
+	err := server.drain(ctx)
+	if onExit != nil {
+		onExit()
+	}
+
+	server.stopOnce.Do(func() { close(server.stopped) })
+	return err
+}
+
+func (server *GeminiServer) drain(ctx context.Context) error {
+	server.peersMu.Lock()
+	server.draining = true
+	server.peersMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		server.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	server.peersMu.Lock()
+	defer server.peersMu.Unlock()
+
+	log.Printf("Shutdown: closing %d remaining connection(s)", len(server.peers))
+	for peer := range server.peers {
+		peer.sock.Close()
+	}
+
+	return ctx.Err()
+}
+
+// on SIGTERM or SIGINT, shuts the server down giving active connections up to grace to
+// finish. onExit (if not nil) is called once that's done, after which Run() returns
+func (server *GeminiServer) ShutdownOnSignal(grace time.Duration, onExit func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		sig := <-sigs
+		signal.Stop(sigs)
+		log.Printf("%s received, draining connections", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+
+		server.shutdown(ctx, onExit)
+	}()
+}
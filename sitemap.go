@@ -0,0 +1,64 @@
+package gemini
+
+import (
+	"path"
+	"strings"
+)
+
+/* =========================================[[ Sitemap ]]========================================= */
+
+// returns a link to toPath relative to the page at fromPath, so the links still work
+// when the router is mounted under a prefix
+func relativeLink(fromPath, toPath string) string {
+	var dirSegments []string
+	if dir := path.Dir(fromPath); dir != "/" {
+		dirSegments = strings.Split(dir[1:], "/")
+	}
+	toSegments := strings.Split(strings.TrimPrefix(toPath, "/"), "/")
+
+	// skip the directories both paths share
+	shared := 0
+	for shared < len(dirSegments) && shared < len(toSegments)-1 && dirSegments[shared] == toSegments[shared] {
+		shared++
+	}
+
+	link := strings.Repeat("../", len(dirSegments)-shared) + strings.Join(toSegments[shared:], "/")
+	if link == "" || strings.Contains(toSegments[shared], ":") {
+		// keep "a:b" from being read as a scheme
+		link = "./" + link
+	}
+	return link
+}
+
+// registers a gemtext page at path listing every route that can be linked to (exact
+// paths, and prefixes like "/static/*") along with their titles & descriptions. the
+// page is built on each request, so routes registered later are listed too. ':param'
+// and regex patterns, redirects and the sitemap itself are left out
+func (pHndlr *pathHandler) SetSitemap(path, title string) *Route {
+	var sitemap *Route
+	sitemap = pHndlr.AddHandler(path, func(peer *GeminiPeer) {
+		body := NewBody()
+		body.AddHeader(title)
+
+		listed := map[string]bool{}
+		for _, route := range pHndlr.routes {
+			if _, isRedirect := route.handler.(*redirectRoute); isRedirect || route.link == "" || route == sitemap || listed[route.link] {
+				continue
+			}
+			listed[route.link] = true
+
+			text := route.Title
+			if text == "" {
+				text = route.link
+			}
+			body.AddLinkLine(relativeLink(sitemap.Path, route.link), text)
+			if route.Description != "" {
+				body.AddTextLine(route.Description)
+			}
+		}
+
+		peer.SendBody(body)
+	})
+
+	return sitemap.WithTitle(title)
+}
@@ -0,0 +1,56 @@
+package gemini
+
+import "time"
+
+/* =======================================[[ Route Stats ]]======================================= */
+
+// counters kept per route by a pathHandler, see pathHandler.Stats()
+type RouteStats struct {
+	Requests uint64
+	Statuses map[int]uint64 // requests answered with each status, 0 if none was sent
+	Duration time.Duration  // total time spent handling the requests
+}
+
+// label unmatched requests are counted under
+const notFoundLabel = "(not found)"
+
+// counts a request handled by route (nil if no route matched)
+func (pHndlr *pathHandler) record(route *Route, peer *GeminiPeer, start time.Time) {
+	label := notFoundLabel
+	if route != nil {
+		label = route.label()
+	}
+
+	pHndlr.statsMu.Lock()
+	defer pHndlr.statsMu.Unlock()
+
+	stats, exists := pHndlr.stats[label]
+	if !exists {
+		stats = &RouteStats{Statuses: map[int]uint64{}}
+		pHndlr.stats[label] = stats
+	}
+
+	stats.Requests++
+	stats.Statuses[peer.status]++
+	stats.Duration += time.Since(start)
+}
+
+// returns a snapshot of the router's counters, keyed by route name (or the path the
+// route was registered with if it has none, eg. "/user/:id"), so they stay few enough to
+// aggregate no matter how many distinct paths are requested. requests no route matched
+// are counted under "(not found)"
+func (pHndlr *pathHandler) Stats() map[string]RouteStats {
+	pHndlr.statsMu.Lock()
+	defer pHndlr.statsMu.Unlock()
+
+	snapshot := make(map[string]RouteStats, len(pHndlr.stats))
+	for label, stats := range pHndlr.stats {
+		statuses := make(map[int]uint64, len(stats.Statuses))
+		for status, n := range stats.Statuses {
+			statuses[status] = n
+		}
+
+		snapshot[label] = RouteStats{Requests: stats.Requests, Statuses: statuses, Duration: stats.Duration}
+	}
+	return snapshot
+}
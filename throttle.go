@@ -0,0 +1,107 @@
+package gemini
+
+import (
+	"sync"
+	"time"
+)
+
+/* ======================================[[ tokenBucket ]]======================================= */
+
+// largest chunk written at once to a throttled peer, keeps the output smooth
+const throttleChunkSize = 16 * 1024
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // max tokens the bucket holds
+	tokens float64
+	last   time.Time
+}
+
+// creates a full bucket refilled at rate tokens per second, holding at most burst tokens
+func newTokenBucket(rate, burst int) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// adds the tokens accumulated since the last refill (tb.mu must be held)
+func (tb *tokenBucket) refill() {
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+}
+
+// takes n tokens from the bucket, returns how long the caller has to wait before
+// they're actually available. the bucket may go into debt
+func (tb *tokenBucket) reserve(n int) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill()
+
+	tb.tokens -= float64(n)
+	if tb.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// takes n tokens from the bucket only if they're all available. otherwise the bucket is
+// left untouched and how long until they will be is returned
+func (tb *tokenBucket) take(n int) (bool, time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill()
+
+	if tb.tokens < float64(n) {
+		return false, time.Duration((float64(n) - tb.tokens) / tb.rate * float64(time.Second))
+	}
+
+	tb.tokens -= float64(n)
+	return true, 0
+}
+
+// blocks until n tokens have been taken from the bucket
+func (tb *tokenBucket) wait(n int) {
+	if delay := tb.reserve(n); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+/* ======================================[[ Throttling ]]======================================== */
+
+// caps the rate at which each peer is sent data to bytesPerSecond. 0 disables the
+// limit (the default). only applies to peers connecting after the call
+func (server *GeminiServer) SetBandwidthLimit(bytesPerSecond int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.bandwidth = bytesPerSecond
+}
+
+// caps the rate at which this peer is sent data to bytesPerSecond, overriding the
+// server's limit. 0 removes the limit
+func (peer *GeminiPeer) SetBandwidthLimit(bytesPerSecond int) {
+	if bytesPerSecond <= 0 {
+		peer.throttle = nil
+		return
+	}
+
+	burst := bytesPerSecond
+	if burst > throttleChunkSize {
+		burst = throttleChunkSize
+	}
+	peer.throttle = newTokenBucket(bytesPerSecond, burst)
+}
+
+// wraps handler so responses it sends are capped at bytesPerSecond
+func Throttle(bytesPerSecond int, handler Handler) Handler {
+	return HandlerFunc(func(peer *GeminiPeer) {
+		peer.SetBandwidthLimit(bytesPerSecond)
+		handler.ServeGemini(peer)
+	})
+}
@@ -0,0 +1,128 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+/* ====================================[[ Handler Timeouts ]]===================================== */
+
+// returns the context of the peer's request. it's cancelled once the connection is
+// closed, or once the budget set by WithTimeout() runs out. long-running handlers (eg.
+// ones calling upstream services) should pass it along and give up when it's done
+func (peer *GeminiPeer) Context() context.Context {
+	if peer.ctx == nil {
+		return context.Background()
+	}
+
+	return peer.ctx
+}
+
+// returns a copy of the peer for handler running in its own goroutine, see WithTimeout().
+// the copy's writes go through peer, everything else it changes (its path, status,
+// context, etc.) is its own, so the handler can't race the peer's goroutine
+func (peer *GeminiPeer) fork(ctx context.Context) *GeminiPeer {
+	return &GeminiPeer{
+		server:     peer.server,
+		sock:       peer.sock,
+		rawURL:     peer.rawURL,
+		hostname:   peer.hostname,
+		path:       peer.path,
+		param:      peer.param,
+		uri:        peer.uri,
+		params:     peer.params,
+		pathParams: peer.pathParams,
+		route:      peer.route,
+		layout:     peer.layout,
+		ctx:        ctx,
+		parent:     peer,
+	}
+}
+
+// same as write(), for forked peers. peer.mu must be held (can panic !)
+func (peer *GeminiPeer) forward(p []byte) {
+	for len(p) > 0 {
+		chunk := p
+		if peer.throttle != nil {
+			if len(chunk) > throttleChunkSize {
+				chunk = chunk[:throttleChunkSize]
+			}
+			peer.throttle.wait(len(chunk))
+		}
+
+		peer.parent.Write(chunk)
+		if peer.capture != nil {
+			peer.capture.Write(chunk)
+		}
+		peer.sent = true
+		p = p[len(chunk):]
+	}
+}
+
+// records the status a forked peer sent, unless the peer was abandoned since
+func (peer *GeminiPeer) setStatus(status int) {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+
+	if peer.abandoned {
+		return
+	}
+
+	if peer.status == 0 {
+		peer.status = status
+	}
+	if peer.parent != nil {
+		peer.parent.setStatus(status)
+	}
+}
+
+// stops the handler serving the peer from sending anything else, answering with
+// StatusTemporaryFailure instead if it hadn't started its response yet (can panic !)
+func (peer *GeminiPeer) abandon(meta string) {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+
+	peer.abandoned = true
+	if peer.sent || peer.closed {
+		return
+	}
+
+	header := []byte(fmt.Sprintf("%d %s\r\n", StatusTemporaryFailure, meta))
+	if peer.parent != nil {
+		peer.forward(header)
+	} else {
+		peer.write(header)
+	}
+	peer.logStatus(StatusTemporaryFailure, meta)
+}
+
+// wraps handler so it has at most d to respond. handler runs in its own goroutine (on a
+// copy of the peer), once d is up the peer is answered with StatusTemporaryFailure (or,
+// if handler already started its response, the connection is closed) and the peer's
+// goroutine moves on. go can't stop handler itself, so it should watch peer.Context();
+// writes it attempts after the deadline panic, and are discarded
+func WithTimeout(d time.Duration, handler Handler) Handler {
+	return HandlerFunc(func(peer *GeminiPeer) {
+		ctx, cancel := context.WithTimeout(peer.Context(), d)
+		defer cancel()
+
+		forked := peer.fork(ctx)
+		done := make(chan any, 1)
+		go func() {
+			defer func() { done <- recover() }()
+			handler.ServeGemini(forked)
+		}()
+
+		select {
+		case r := <-done:
+			if r != nil {
+				panic(r)
+			}
+		case <-ctx.Done():
+			// nothing is sent if the connection was closed from under us, but the
+			// handler still mustn't touch the peer anymore
+			peer.abandon("Request timed out!")
+		}
+	})
+}
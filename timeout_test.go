@@ -0,0 +1,46 @@
+package gemini
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	finished := make(chan struct{})
+	router := NewHandler()
+	var paths []string
+	router.Use(func(next Handler) Handler {
+		return HandlerFunc(func(peer *GeminiPeer) {
+			next.ServeGemini(peer)
+			paths = append(paths, peer.path) // eg. an access log
+		})
+	})
+	router.Handle("/fast", WithTimeout(time.Second, HandlerFunc(named("fast"))))
+	router.Handle("/slow", WithTimeout(10*time.Millisecond, HandlerFunc(func(peer *GeminiPeer) {
+		defer close(finished)
+		<-peer.Context().Done()
+		time.Sleep(20 * time.Millisecond)
+
+		// the abandoned handler keeps going while the connection is closed & logged
+		peer.path = "/elsewhere"
+		peer.SendInput("late")
+	})))
+
+	checkRoutes(t, router, []routeTest{
+		{"/fast", "10 fast"},
+		{"/slow", "40 Request timed out!"},
+	})
+	<-finished
+
+	if len(paths) != 2 || paths[1] != "/slow" {
+		t.Errorf("got paths %v, the abandoned handler mustn't change the peer's", paths)
+	}
+
+	stats := router.Stats()
+	if got := stats["/fast"].Statuses; got[10] != 1 {
+		t.Errorf("/fast: got statuses %v, want one 10", got)
+	}
+	if got := stats["/slow"].Statuses; got[40] != 1 {
+		t.Errorf("/slow: got statuses %v, want one 40", got)
+	}
+}
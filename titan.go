@@ -0,0 +1,88 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/* ======================================[[ Titan Uploads ]]====================================== */
+
+// a payload to upload with the Titan protocol, see Client.Upload()
+type TitanUpload struct {
+	Mime  string // the payload's mime type, "" leaves it to the server (text/gemini)
+	Token string // if set, authorizes the upload, eg. a password the server was set up with
+	Size  int64  // exactly this many bytes are read from Body
+	Body  io.Reader
+}
+
+// returns rawURL with the upload's parameters, eg.
+// "titan://example.org/page.gmi;mime=text/plain;size=12;token=secret"
+func (upload *TitanUpload) url(reqURL *url.URL) (*url.URL, error) {
+	params := ";size=" + strconv.FormatInt(upload.Size, 10)
+	if upload.Mime != "" {
+		// servers expect the '/' of a mime type as-is
+		params = ";mime=" + strings.ReplaceAll(url.PathEscape(upload.Mime), "%2F", "/") + params
+	}
+	if upload.Token != "" {
+		params += ";token=" + url.PathEscape(upload.Token)
+	}
+
+	// the parameters go at the end of the path, a query would come after them
+	base := *reqURL
+	base.RawQuery, base.ForceQuery, base.Fragment = "", false, ""
+	titanURL, err := url.Parse(base.String() + params)
+	if err != nil {
+		return nil, err
+	}
+	titanURL.RawQuery = reqURL.RawQuery
+	return titanURL, nil
+}
+
+// writes the payload to w
+func (upload *TitanUpload) send(w io.Writer) error {
+	if upload.Size == 0 {
+		return nil
+	}
+	if upload.Body == nil {
+		return fmt.Errorf("gemini: upload of %d bytes has no body", upload.Size)
+	}
+
+	sent, err := io.CopyN(w, upload.Body, upload.Size)
+	if err == io.EOF {
+		return fmt.Errorf("gemini: upload body ended after %d of %d bytes", sent, upload.Size)
+	}
+	return err
+}
+
+// uploads a payload to a "titan://" url (eg. "titan://example.org/page.gmi") on a
+// Titan-enabled server, see TitanUpload. the response is returned as-is, servers usually
+// redirect to the "gemini://" url of what was uploaded. redirects aren't followed, nor
+// failed uploads retried, as the payload can't be sent again
+func (client *Client) Upload(rawURL string, upload *TitanUpload) (*Response, error) {
+	return client.UploadContext(context.Background(), rawURL, upload)
+}
+
+// same as Upload(), the upload is aborted (with ctx.Err()) once ctx is cancelled or its
+// deadline passes
+func (client *Client) UploadContext(ctx context.Context, rawURL string, upload *TitanUpload) (*Response, error) {
+	reqURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if reqURL.Scheme != "titan" || reqURL.Host == "" {
+		return nil, fmt.Errorf("gemini: '%s' isn't a titan:// url", rawURL)
+	}
+	if upload.Size < 0 {
+		return nil, fmt.Errorf("gemini: bad upload size %d", upload.Size)
+	}
+
+	titanURL, err := upload.url(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	return client.fetch(ctx, "", titanURL, upload)
+}
@@ -0,0 +1,95 @@
+package gemini
+
+import (
+	"crypto/tls"
+)
+
+/* =======================================[[ TLS Config ]]======================================== */
+
+type certPair struct {
+	certFile string
+	keyFile  string
+}
+
+// builds the config used for new handshakes from the server's current settings. peers
+// are asked for (but not required to send) a client certificate, which isn't verified
+// since gemini identities are self-signed. the caller must hold server.mu
+func (server *GeminiServer) updateTLSConfig() {
+	server.tlsConfig.Store(&tls.Config{
+		Certificates:     server.certs,
+		ClientAuth:       tls.RequestClientCert,
+		MinVersion:       server.tlsMinVersion,
+		MaxVersion:       server.tlsMaxVersion,
+		CipherSuites:     server.cipherSuites,
+		CurvePreferences: server.curves,
+	})
+}
+
+// (re)loads the server's key pairs from disk. if any of them fail to load, the
+// previously loaded certificates are kept
+func (server *GeminiServer) loadCertificates() error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	certs := make([]tls.Certificate, 0, len(server.certPairs))
+	for _, pair := range server.certPairs {
+		cert, err := tls.LoadX509KeyPair(pair.certFile, pair.keyFile)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	server.certs = certs
+	server.updateTLSConfig()
+	return nil
+}
+
+// adds another key pair to the server. during the handshake the certificate matching
+// the SNI hostname sent by the peer is picked, falling back to the certificate passed
+// to NewServer(). reloaded along with the others by Reload()
+func (server *GeminiServer) AddCertificate(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.certPairs = append(server.certPairs, certPair{certFile, keyFile})
+	server.certs = append(server.certs, cert)
+	server.updateTLSConfig()
+	return nil
+}
+
+// sets the range of TLS versions (eg. tls.VersionTLS13) accepted from peers. 0 for
+// either bound means go's default. the minimum defaults to TLS 1.2
+func (server *GeminiServer) SetTLSVersions(min, max uint16) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.tlsMinVersion = min
+	server.tlsMaxVersion = max
+	server.updateTLSConfig()
+}
+
+// restricts the cipher suites (eg. tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256) offered
+// for TLS 1.2 and below. TLS 1.3 suites aren't configurable. no suites means go's default
+func (server *GeminiServer) SetCipherSuites(suites ...uint16) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.cipherSuites = suites
+	server.updateTLSConfig()
+}
+
+// sets the elliptic curves used for key exchange, in order of preference. no curves
+// means go's default
+func (server *GeminiServer) SetCurvePreferences(curves ...tls.CurveID) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.curves = curves
+	server.updateTLSConfig()
+}
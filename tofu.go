@@ -0,0 +1,185 @@
+package gemini
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =======================================[[ Known Hosts ]]======================================= */
+
+// a host's trusted certificate, as remembered by KnownHosts
+type KnownHost struct {
+	Host        string
+	Fingerprint string // see Fingerprint()
+	Expires     time.Time
+}
+
+// trust on first use (TOFU) certificate store: the first certificate a host presents is
+// remembered, and later connections must present the same one until it expires. hosts
+// are kept in a known_hosts style file with a line per host:
+//
+//	example.org SHA256:5f1a...c3 2030-01-02T15:04:05Z
+type KnownHosts struct {
+	mu    sync.Mutex
+	path  string
+	hosts map[string]KnownHost
+}
+
+// returned (wrapped in a *CertMismatchError) when a host presents a certificate other than
+// the one it's known by
+var ErrCertMismatch = errors.New("gemini: certificate doesn't match the known host's")
+
+type CertMismatchError struct {
+	Host     string
+	Known    KnownHost
+	Received string // the fingerprint of the presented certificate
+}
+
+func (err *CertMismatchError) Error() string {
+	return fmt.Sprintf("gemini: certificate of '%s' changed (known as %s until %s, received %s)",
+		err.Host, err.Known.Fingerprint, err.Known.Expires.Format("2006-01-02"), err.Received)
+}
+
+func (err *CertMismatchError) Unwrap() error {
+	return ErrCertMismatch
+}
+
+// returns the SHA-256 fingerprint of a certificate in lowercase hex, eg. "SHA256:5f1a...c3".
+// it's what hosts are remembered by, and what identifies client certificates to CGI
+// scripts (TLS_CLIENT_HASH) and RateLimitByCert()
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return "SHA256:" + hex.EncodeToString(sum[:])
+}
+
+// loads the known hosts file at path, a missing file is treated as empty (it's created
+// when the first host is added). a path of "" keeps the hosts in memory only
+func LoadKnownHosts(path string) (*KnownHosts, error) {
+	known := &KnownHosts{path: path, hosts: map[string]KnownHost{}}
+	if path == "" {
+		return known, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return known, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected '<host> <fingerprint> <expiry>'", path, lineNum)
+		}
+
+		expires, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad expiry: %w", path, lineNum, err)
+		}
+		known.hosts[fields[0]] = KnownHost{Host: fields[0], Fingerprint: fields[1], Expires: expires}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return known, nil
+}
+
+// returns the certificate host is known by, if any
+func (known *KnownHosts) Lookup(host string) (KnownHost, bool) {
+	known.mu.Lock()
+	defer known.mu.Unlock()
+
+	entry, exists := known.hosts[host]
+	return entry, exists
+}
+
+// trusts cert for host (replacing any certificate it was known by) and saves the file
+func (known *KnownHosts) Add(host string, cert *x509.Certificate) error {
+	known.mu.Lock()
+	defer known.mu.Unlock()
+
+	known.hosts[host] = KnownHost{Host: host, Fingerprint: Fingerprint(cert), Expires: cert.NotAfter.UTC()}
+	return known.save()
+}
+
+// forgets host (eg. after the user confirmed its new certificate is legit) and saves the file
+func (known *KnownHosts) Remove(host string) error {
+	known.mu.Lock()
+	defer known.mu.Unlock()
+
+	delete(known.hosts, host)
+	return known.save()
+}
+
+// checks cert against the one host is known by. unknown hosts, and hosts whose known
+// certificate expired, are trusted with cert from now on
+func (known *KnownHosts) Verify(host string, cert *x509.Certificate) error {
+	known.mu.Lock()
+	defer known.mu.Unlock()
+
+	fingerprint := Fingerprint(cert)
+	entry, exists := known.hosts[host]
+	if exists && entry.Fingerprint == fingerprint {
+		return nil
+	}
+	if exists && time.Now().Before(entry.Expires) {
+		return &CertMismatchError{Host: host, Known: entry, Received: fingerprint}
+	}
+
+	known.hosts[host] = KnownHost{Host: host, Fingerprint: fingerprint, Expires: cert.NotAfter.UTC()}
+	return known.save()
+}
+
+// writes the hosts to the file, replacing it in one go so a crash can't leave it half
+// written. expects known.mu to be held
+func (known *KnownHosts) save() error {
+	if known.path == "" {
+		return nil
+	}
+
+	hosts := make([]string, 0, len(known.hosts))
+	for host := range known.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var sb strings.Builder
+	for _, host := range hosts {
+		entry := known.hosts[host]
+		fmt.Fprintf(&sb, "%s %s %s\n", entry.Host, entry.Fingerprint, entry.Expires.Format(time.RFC3339))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(known.path), ".known_hosts-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	if _, err := tmp.WriteString(sb.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), known.path)
+}
@@ -0,0 +1,135 @@
+package gemini
+
+import (
+	"bufio"
+	"html"
+	"io"
+	"strings"
+)
+
+/* =====================================[[ Gemtext to HTML ]]===================================== */
+
+// class attributes given to the elements rendered by an HTMLRenderer, "" for none
+type HTMLClasses struct {
+	Text    string // <p>
+	Link    string // <p> around each link
+	Heading string // <h1>, <h2> & <h3>
+	List    string // <ul>
+	Quote   string // <blockquote>
+	Pre     string // <pre>
+}
+
+// renders parsed gemtext (see ParseGemtext()) as HTML. the zero value is ready to use
+type HTMLRenderer struct {
+	Classes HTMLClasses
+
+	// if set, maps each link's url to the href it's rendered with, eg. to point
+	// "gemini://" links at a web proxy or ".gmi" links at mirrored ".html" pages
+	RewriteLink func(url string) string
+}
+
+// schemes that would run code in the browser, links using them are neutered
+var unsafeHrefSchemes = []string{"javascript:", "vbscript:", "data:"}
+
+func (renderer *HTMLRenderer) href(url string) string {
+	if renderer.RewriteLink != nil {
+		url = renderer.RewriteLink(url)
+	}
+
+	lower := strings.ToLower(strings.TrimSpace(url))
+	for _, scheme := range unsafeHrefSchemes {
+		if strings.HasPrefix(lower, scheme) {
+			return "#"
+		}
+	}
+	return url
+}
+
+// returns ` class="..."`, or "" if class is empty
+func classAttr(class string) string {
+	if class == "" {
+		return ""
+	}
+	return ` class="` + html.EscapeString(class) + `"`
+}
+
+// writes lines as HTML to w. consecutive list items are grouped in a <ul>, consecutive
+// quote lines in a <blockquote>, and blank lines are dropped. only the elements are
+// written, wrap them in a page of your own
+func (renderer *HTMLRenderer) Render(w io.Writer, lines []GemtextLine) error {
+	out := bufio.NewWriter(w)
+	classes := renderer.Classes
+	esc := html.EscapeString
+
+	var open string // "ul" or "blockquote" when a group is open
+	for i, line := range lines {
+		group := ""
+		switch line.(type) {
+		case *ListItemLine:
+			group = "ul"
+		case *QuoteLine:
+			group = "blockquote"
+		}
+
+		// close (or open) list & quote groups as needed
+		if open != "" && group != open {
+			out.WriteString("</" + open + ">\n")
+			open = ""
+		}
+		if group != "" && open == "" {
+			class := classes.List
+			if group == "blockquote" {
+				class = classes.Quote
+			}
+			out.WriteString("<" + group + classAttr(class) + ">\n")
+			open = group
+		}
+
+		switch line := line.(type) {
+		case *TextLine:
+			if strings.TrimSpace(line.Text) != "" {
+				out.WriteString("<p" + classAttr(classes.Text) + ">" + esc(line.Text) + "</p>\n")
+			}
+		case *LinkLine:
+			text := line.Text
+			if text == "" {
+				text = line.URL
+			}
+			out.WriteString("<p" + classAttr(classes.Link) + `><a href="` + esc(renderer.href(line.URL)) + `">` + esc(text) + "</a></p>\n")
+		case *HeadingLine:
+			tag := "h" + string(rune('0'+line.Level))
+			out.WriteString("<" + tag + classAttr(classes.Heading) + ">" + esc(line.Text) + "</" + tag + ">\n")
+		case *ListItemLine:
+			out.WriteString("<li>" + esc(line.Text) + "</li>\n")
+		case *QuoteLine:
+			out.WriteString(esc(line.Text))
+			if next := i + 1; next < len(lines) {
+				if _, ok := lines[next].(*QuoteLine); ok {
+					out.WriteString("<br>")
+				}
+			}
+			out.WriteString("\n")
+		case *PreformattedBlock:
+			label := ""
+			if line.Alt != "" {
+				label = ` aria-label="` + esc(line.Alt) + `"`
+			}
+			out.WriteString("<pre" + classAttr(classes.Pre) + label + ">" + esc(strings.Join(line.Lines, "\n")) + "</pre>\n")
+		}
+	}
+
+	if open != "" {
+		out.WriteString("</" + open + ">\n")
+	}
+	return out.Flush()
+}
+
+// renders the gemtext document src as HTML with the default renderer, see
+// HTMLRenderer.Render()
+func GemtextToHTML(src string) string {
+	lines, _ := ParseGemtext(strings.NewReader(src)) // can't fail reading a string
+
+	var sb strings.Builder
+	(&HTMLRenderer{}).Render(&sb, lines)
+	return sb.String()
+}
@@ -0,0 +1,122 @@
+package gemini
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+/* =======================================[[ URL Builder ]]======================================= */
+
+// assembles a gemini url from its parts, percent-encoding each of them, eg.
+//
+//	gemini.NewURL("example.org").Path("search").Input("café au lait").String()
+//
+// returns "gemini://example.org/search?caf%C3%A9%20au%20lait"
+type URLBuilder struct {
+	scheme   string
+	host     string
+	port     string
+	segments []string
+	rawPath  string   // see RawPath(), overrides segments if set
+	query    []string // already escaped
+}
+
+// starts a "gemini://" url for host, which may include a port ("example.org:1966") and
+// may be an ipv6 literal ("::1" or "[::1]:1966")
+func NewURL(host string) *URLBuilder {
+	builder := &URLBuilder{scheme: "gemini", host: host}
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		builder.host, builder.port = hostname, port
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		builder.host = host[1 : len(host)-1]
+	}
+	return builder
+}
+
+// sets the scheme, eg. "titan"
+func (builder *URLBuilder) Scheme(scheme string) *URLBuilder {
+	builder.scheme = scheme
+	return builder
+}
+
+// sets the port, "" (the default) leaves it out
+func (builder *URLBuilder) Port(port string) *URLBuilder {
+	builder.port = port
+	return builder
+}
+
+// appends path segments, each escaped on its own (so a '/' inside one is kept in it).
+// ending with "" gives the path a trailing slash, eg. Path("log", "") is "/log/"
+func (builder *URLBuilder) Path(segments ...string) *URLBuilder {
+	builder.segments = append(builder.segments, segments...)
+	builder.rawPath = ""
+	return builder
+}
+
+// sets the path as-is, it must already be escaped (eg. "/caf%C3%A9/menu.gmi"). replaces
+// any segments added by Path()
+func (builder *URLBuilder) RawPath(path string) *URLBuilder {
+	builder.rawPath, builder.segments = path, nil
+	return builder
+}
+
+// sets the whole query as-is, it must already be escaped
+func (builder *URLBuilder) RawQuery(query string) *URLBuilder {
+	builder.query = []string{query}
+	return builder
+}
+
+// sets the whole query to value, the way clients answer input (10 & 11) responses
+func (builder *URLBuilder) Input(value string) *URLBuilder {
+	builder.query = []string{escapeQuery(value)}
+	return builder
+}
+
+// appends a key=value pair to the query
+func (builder *URLBuilder) Query(key, value string) *URLBuilder {
+	builder.query = append(builder.query, escapeQuery(key)+"="+escapeQuery(value))
+	return builder
+}
+
+func (builder *URLBuilder) String() string {
+	var sb strings.Builder
+	sb.WriteString(builder.scheme + "://")
+
+	// only ipv6 literals are bracketed
+	host := builder.host
+	if ip := net.ParseIP(host); ip != nil && strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if builder.port != "" {
+		host += ":" + builder.port
+	}
+	sb.WriteString(host)
+
+	switch {
+	case builder.rawPath != "":
+		if !strings.HasPrefix(builder.rawPath, "/") {
+			sb.WriteByte('/')
+		}
+		sb.WriteString(builder.rawPath)
+	default:
+		sb.WriteByte('/')
+		for i, segment := range builder.segments {
+			if i > 0 {
+				sb.WriteByte('/')
+			}
+			sb.WriteString(url.PathEscape(segment))
+		}
+	}
+
+	if len(builder.query) > 0 {
+		sb.WriteString("?" + strings.Join(builder.query, "&"))
+	}
+	return sb.String()
+}
+
+// percent-encodes s for a query, spaces are encoded as "%20" as "+" means just that
+// in gemini
+func escapeQuery(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,27 @@
+package gemini
+
+import "testing"
+
+func TestURLBuilder(t *testing.T) {
+	tests := []struct {
+		builder *URLBuilder
+		want    string
+	}{
+		{NewURL("example.org"), "gemini://example.org/"},
+		{NewURL("example.org:1966"), "gemini://example.org:1966/"},
+		{NewURL("::1"), "gemini://[::1]/"},
+		{NewURL("[::1]"), "gemini://[::1]/"},
+		{NewURL("[::1]:1966"), "gemini://[::1]:1966/"},
+		{NewURL("example.org").Scheme("titan").Port("1966"), "titan://example.org:1966/"},
+		{NewURL("example.org").Path("a b", "c/d", ""), "gemini://example.org/a%20b/c%2Fd/"},
+		{NewURL("example.org").Path("search").Input("why? #1 fan"), "gemini://example.org/search?why%3F%20%231%20fan"},
+		{NewURL("example.org").Query("q", "a+b").Query("lang", "en"), "gemini://example.org/?q=a%2Bb&lang=en"},
+		{NewURL("example.org").RawPath("/a%20b").RawQuery("x=1&y"), "gemini://example.org/a%20b?x=1&y"},
+	}
+
+	for _, test := range tests {
+		if got := test.builder.String(); got != test.want {
+			t.Errorf("got '%s', want '%s'", got, test.want)
+		}
+	}
+}
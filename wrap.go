@@ -0,0 +1,108 @@
+package gemini
+
+import (
+	"strings"
+	"unicode"
+)
+
+/* ======================================[[ Word Wrapping ]]====================================== */
+
+// ranges of runes shown two columns wide by terminals (east asian wide & fullwidth
+// characters, and emoji)
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115F},   // hangul jamo
+	{0x2E80, 0x303E},   // cjk radicals .. cjk symbols & punctuation
+	{0x3041, 0x33FF},   // hiragana .. cjk compatibility
+	{0x3400, 0x4DBF},   // cjk unified ideographs extension a
+	{0x4E00, 0x9FFF},   // cjk unified ideographs
+	{0xA000, 0xA4CF},   // yi
+	{0xAC00, 0xD7A3},   // hangul syllables
+	{0xF900, 0xFAFF},   // cjk compatibility ideographs
+	{0xFE30, 0xFE4F},   // cjk compatibility forms
+	{0xFF00, 0xFF60},   // fullwidth forms
+	{0xFFE0, 0xFFE6},   // fullwidth signs
+	{0x1F300, 0x1F64F}, // misc symbols & pictographs, emoticons
+	{0x1F900, 0x1F9FF}, // supplemental symbols & pictographs
+	{0x20000, 0x3FFFD}, // cjk extensions b ..
+}
+
+// returns the number of columns r takes up in a monospace terminal
+func runeWidth(r rune) int {
+	switch {
+	case r == 0 || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || unicode.Is(unicode.Cf, r):
+		return 0 // combining marks & invisible formatting
+	case r < 0x1100:
+		return 1
+	}
+
+	for _, wide := range wideRanges {
+		if r >= wide.lo && r <= wide.hi {
+			return 2
+		}
+	}
+	return 1
+}
+
+// returns the number of columns str takes up in a monospace terminal
+func StringWidth(str string) int {
+	width := 0
+	for _, r := range str {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// reflows text into lines at most width columns wide (wide characters, eg. CJK, count as
+// two columns), breaking at spaces. words wider than a line are split, and newlines in
+// text are kept as hard breaks. a width < 1 returns text's lines unwrapped
+func WrapText(text string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if width < 1 {
+			lines = append(lines, para)
+			continue
+		}
+
+		var line strings.Builder
+		lineWidth := 0
+		for _, word := range strings.Fields(para) {
+			wordWidth := StringWidth(word)
+
+			if lineWidth > 0 && lineWidth+1+wordWidth > width {
+				lines = append(lines, line.String())
+				line.Reset()
+				lineWidth = 0
+			}
+			if lineWidth > 0 {
+				line.WriteByte(' ')
+				lineWidth++
+			}
+
+			// split words that don't fit on a line of their own
+			for _, r := range word {
+				w := runeWidth(r)
+				if lineWidth > 0 && lineWidth+w > width {
+					lines = append(lines, line.String())
+					line.Reset()
+					lineWidth = 0
+				}
+				line.WriteRune(r)
+				lineWidth += w
+			}
+		}
+		lines = append(lines, line.String())
+	}
+
+	return lines
+}
+
+// same as AddTextLine(), with str reflowed into lines at most width columns wide (see
+// WrapText()), for the clients that don't wrap long lines themselves. wrapped lines that
+// would read as another line type are escaped (see EscapeText())
+func (body *GeminiBody) AddWrappedTextLine(str string, width int) {
+	for _, line := range WrapText(str, width) {
+		body.buf.WriteString(EscapeText(line))
+		body.buf.WriteByte('\n')
+	}
+	body.buf.WriteByte('\n')
+}